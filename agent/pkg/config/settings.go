@@ -2,7 +2,11 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 )
 
 type Config struct {
@@ -12,7 +16,132 @@ type Config struct {
 	IgnoredProjects []string `json:"ignored_projects"`
 	CpuThreshold    int      `json:"cpu_threshold"`
 	NginxLogPath    string   `json:"nginx_log_path"`
-	PhpFpmPath      string   `json:"php_fpm_path"` // Manual override
+	NginxLogFormat  string   `json:"nginx_log_format"` // log_format of NginxLogPath; empty for combined
+	PhpFpmPath      string   `json:"php_fpm_path"`     // Manual override
+
+	// FastCGI address of the FPM pool (host:port or socket path) and its pm.status_path
+	PhpFpmAddress    string `json:"php_fpm_address"`
+	PhpFpmStatusPath string `json:"php_fpm_status_path"`
+
+	// Persistent metrics (~/.sentinel/metrics) and traces; 0 keeps everything
+	MetricsRetentionHours int `json:"metrics_retention_hours"` // Default 72
+	MetricsMaxSizeMB      int `json:"metrics_max_size_mb"`     // Default 256, metrics only
+
+	// Same query fingerprint repeated this often in one request is flagged as N+1
+	NPlusOneThreshold int `json:"n_plus_one_threshold"`
+
+	// Audit probe settings, rendered into the inspector on injection
+	Probe          ProbeConfig              `json:"probe"`
+	ProbeOverrides map[string]ProbeOverride `json:"probe_overrides"` // Key: ProjectPath
+
+	// Ingested entries accepted per second before /projects/ingest starts dropping (0 is unlimited)
+	IngestRateLimit int `json:"ingest_rate_limit"`
+
+	// Non-blocking probe transports, read by the agent when present. The agent
+	// only sets permissions on a directory it creates; for an existing one,
+	// the PHP user needs write access to it.
+	SpoolPath  string `json:"spool_path"`
+	SocketPath string `json:"socket_path"`
+
+	// OpenTelemetry export of ingested entries, off unless Endpoint is set
+	OTLP OTLPConfig `json:"otlp"`
+
+	// Watchdog rules. Empty means a single FPM CPU rule at CpuThreshold.
+	Rules []Rule `json:"rules"`
+
+	// Where opened and resolved incidents are sent
+	NotificationSinks []SinkConfig `json:"notification_sinks"`
+}
+
+// Notification sink types
+const (
+	SinkWebhook = "webhook" // JSON POST, signed with HMAC-SHA256 when Secret is set
+	SinkSlack   = "slack"   // Slack/Mattermost incoming webhook
+	SinkDesktop = "desktop" // notify-send (Linux)
+	SinkCommand = "command" // Local command, event JSON on stdin; only set from the config file
+)
+
+type SinkConfig struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	URL         string   `json:"url,omitempty"`     // webhook, slack
+	Secret      string   `json:"secret,omitempty"`  // webhook
+	Command     string   `json:"command,omitempty"` // command
+	Args        []string `json:"args,omitempty"`    // command
+	MinSeverity string   `json:"min_severity,omitempty"`
+	MaxRetries  int      `json:"max_retries"` // Default 3
+	Disabled    bool     `json:"disabled,omitempty"`
+}
+
+// Rule fires an incident when Metric compares true against Threshold for ForSeconds.
+// Metric names are listed in the watchdog package.
+type Rule struct {
+	Name            string  `json:"name"`
+	Metric          string  `json:"metric"`
+	Comparison      string  `json:"comparison"` // >, >=, <, <=, ==, !=
+	Threshold       float64 `json:"threshold"`
+	ForSeconds      int     `json:"for_seconds"`      // Sustained this long before firing (0 fires at once)
+	CooldownSeconds int     `json:"cooldown_seconds"` // No new incident from this rule for this long (default 60)
+	ExpireSeconds   int     `json:"expire_seconds"`   // How long /alerts shows the incident (default 300)
+	Severity        string  `json:"severity"`         // info, warning or critical (default warning)
+
+	// Metrics computed from ingested entries or logs
+	Project       string `json:"project,omitempty"` // Project path; empty means every project
+	WindowSeconds int    `json:"window_seconds"`    // Look-back window (default 300)
+
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// OTLPConfig points the agent at an OTLP/HTTP collector (Jaeger, Tempo, otel-collector)
+type OTLPConfig struct {
+	Endpoint        string            `json:"endpoint"`     // Base URL, e.g. http://localhost:4318
+	Headers         map[string]string `json:"headers"`      // e.g. auth tokens
+	ServiceName     string            `json:"service_name"` // Defaults to the project directory name
+	BatchSize       int               `json:"batch_size"`
+	FlushIntervalMS int               `json:"flush_interval_ms"`
+	MaxRetries      int               `json:"max_retries"`
+	Metrics         bool              `json:"metrics"` // Also export request duration histograms
+}
+
+// Probe transports
+const (
+	TransportHTTP   = "http"   // POST per request to /projects/ingest
+	TransportSpool  = "spool"  // Append NDJSON to SpoolPath
+	TransportSocket = "socket" // Datagram to the Unix socket at SocketPath
+)
+
+type ProbeConfig struct {
+	Transport       string  `json:"transport"`
+	SlowQueryMS     float64 `json:"slow_query_ms"`
+	SampleRate      float64 `json:"sample_rate"`     // Percent of requests reported (0-100)
+	MinDurationMS   float64 `json:"min_duration_ms"` // Only report requests at least this slow
+	CaptureBindings bool    `json:"capture_bindings"`
+	TimeoutMS       int     `json:"timeout_ms"`
+	Traces          bool    `json:"traces"` // Record a span tree per sampled request
+}
+
+// ProbeOverride replaces the fields that are set for a single project
+type ProbeOverride struct {
+	Transport       *string  `json:"transport,omitempty"`
+	SlowQueryMS     *float64 `json:"slow_query_ms,omitempty"`
+	SampleRate      *float64 `json:"sample_rate,omitempty"`
+	MinDurationMS   *float64 `json:"min_duration_ms,omitempty"`
+	CaptureBindings *bool    `json:"capture_bindings,omitempty"`
+	TimeoutMS       *int     `json:"timeout_ms,omitempty"`
+	Traces          *bool    `json:"traces,omitempty"`
+}
+
+var defaultOTLP = OTLPConfig{
+	BatchSize:       200,
+	FlushIntervalMS: 5000,
+	MaxRetries:      3,
+}
+
+var defaultProbe = ProbeConfig{
+	Transport:   TransportHTTP,
+	SlowQueryMS: 50,
+	SampleRate:  100,
+	TimeoutMS:   200,
 }
 
 const ConfigFile = "sentinel-config.json"
@@ -23,8 +152,19 @@ func Load() (Config, error) {
 	if os.IsNotExist(err) {
 		// Return default config if not exists
 		return Config{
-			Host: "127.0.0.1",
-			Port: 8888,
+			Host:                  "127.0.0.1",
+			Port:                  8888,
+			PhpFpmAddress:         "127.0.0.1:9000",
+			PhpFpmStatusPath:      "/status",
+			CpuThreshold:          50,
+			MetricsRetentionHours: 72,
+			MetricsMaxSizeMB:      256,
+			NPlusOneThreshold:     5,
+			Probe:                 defaultProbe,
+			IngestRateLimit:       200,
+			SpoolPath:             defaultSpoolPath(),
+			SocketPath:            defaultSocketPath(),
+			OTLP:                  defaultOTLP,
 		}, nil
 	}
 	if err != nil {
@@ -32,6 +172,18 @@ func Load() (Config, error) {
 	}
 	err = json.Unmarshal(file, &cfg)
 
+	// Settings where 0 means something (keep everything, no limit, sample nothing) only get
+	// their default when they're missing from the file
+	var set struct {
+		MetricsRetentionHours *int `json:"metrics_retention_hours"`
+		MetricsMaxSizeMB      *int `json:"metrics_max_size_mb"`
+		IngestRateLimit       *int `json:"ingest_rate_limit"`
+		Probe                 struct {
+			SampleRate *float64 `json:"sample_rate"`
+		} `json:"probe"`
+	}
+	json.Unmarshal(file, &set)
+
 	// Set defaults if empty
 	if cfg.Host == "" {
 		cfg.Host = "127.0.0.1"
@@ -39,13 +191,123 @@ func Load() (Config, error) {
 	if cfg.Port == 0 {
 		cfg.Port = 8888
 	}
+	if cfg.PhpFpmAddress == "" {
+		cfg.PhpFpmAddress = "127.0.0.1:9000"
+	}
+	if cfg.PhpFpmStatusPath == "" {
+		cfg.PhpFpmStatusPath = "/status"
+	}
 	if cfg.CpuThreshold == 0 {
 		cfg.CpuThreshold = 50
 	}
+	if set.MetricsRetentionHours == nil {
+		cfg.MetricsRetentionHours = 72
+	}
+	if set.MetricsMaxSizeMB == nil {
+		cfg.MetricsMaxSizeMB = 256
+	}
+	if cfg.NPlusOneThreshold == 0 {
+		cfg.NPlusOneThreshold = 5
+	}
+	if set.IngestRateLimit == nil {
+		cfg.IngestRateLimit = 200
+	}
+	if cfg.SpoolPath == "" {
+		cfg.SpoolPath = defaultSpoolPath()
+	}
+	if cfg.SocketPath == "" {
+		cfg.SocketPath = defaultSocketPath()
+	}
+	if cfg.Probe.Transport == "" {
+		cfg.Probe.Transport = defaultProbe.Transport
+	}
+	if cfg.Probe.SlowQueryMS == 0 {
+		cfg.Probe.SlowQueryMS = defaultProbe.SlowQueryMS
+	}
+	if set.Probe.SampleRate == nil {
+		cfg.Probe.SampleRate = defaultProbe.SampleRate
+	}
+	if cfg.Probe.TimeoutMS == 0 {
+		cfg.Probe.TimeoutMS = defaultProbe.TimeoutMS
+	}
+	if cfg.OTLP.BatchSize == 0 {
+		cfg.OTLP.BatchSize = defaultOTLP.BatchSize
+	}
+	if cfg.OTLP.FlushIntervalMS == 0 {
+		cfg.OTLP.FlushIntervalMS = defaultOTLP.FlushIntervalMS
+	}
+	if cfg.OTLP.MaxRetries == 0 {
+		cfg.OTLP.MaxRetries = defaultOTLP.MaxRetries
+	}
 
 	return cfg, err
 }
 
+// Shared temp dir, since PHP-FPM workers usually can't write to the agent user's home.
+// A dedicated directory owned by the agent lets it rotate a spool file owned by
+// the FPM user, which /tmp's sticky bit would prevent.
+func defaultSpoolPath() string {
+	return filepath.Join(os.TempDir(), "sentinel", "ingest.ndjson")
+}
+
+func defaultSocketPath() string {
+	return filepath.Join(os.TempDir(), "sentinel", "ingest.sock")
+}
+
+// ProbeFor returns the probe settings for a project, with its overrides applied
+func (c *Config) ProbeFor(projectPath string) ProbeConfig {
+	probe := c.Probe
+	override, ok := c.ProbeOverrides[projectPath]
+	if !ok {
+		return probe
+	}
+
+	if override.Transport != nil {
+		probe.Transport = *override.Transport
+	}
+	if override.SlowQueryMS != nil {
+		probe.SlowQueryMS = *override.SlowQueryMS
+	}
+	if override.SampleRate != nil {
+		probe.SampleRate = *override.SampleRate
+	}
+	if override.MinDurationMS != nil {
+		probe.MinDurationMS = *override.MinDurationMS
+	}
+	if override.CaptureBindings != nil {
+		probe.CaptureBindings = *override.CaptureBindings
+	}
+	if override.TimeoutMS != nil {
+		probe.TimeoutMS = *override.TimeoutMS
+	}
+	if override.Traces != nil {
+		probe.Traces = *override.Traces
+	}
+	return probe
+}
+
+// WatchdogRules returns the configured rules, or the CPU rule CpuThreshold has always meant
+func (c *Config) WatchdogRules() []Rule {
+	if len(c.Rules) > 0 {
+		return c.Rules
+	}
+	return []Rule{{
+		Name:       "php-fpm-cpu",
+		Metric:     "php_fpm_cpu_percent",
+		Comparison: ">=",
+		Threshold:  float64(c.CpuThreshold),
+	}}
+}
+
+// AgentURL is the address PHP processes on this machine use to reach the agent
+func (c *Config) AgentURL() string {
+	host := c.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return fmt.Sprintf("http://%s", net.JoinHostPort(host, strconv.Itoa(c.Port)))
+}
+
 func (c *Config) Save() error {
 	data, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
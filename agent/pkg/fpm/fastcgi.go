@@ -0,0 +1,171 @@
+package fpm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FastCGI record types (FastCGI spec, section 8)
+const (
+	fcgiVersion      = 1
+	typeBeginRequest = 1
+	typeEndRequest   = 3
+	typeParams       = 4
+	typeStdin        = 5
+	typeStdout       = 6
+	typeStderr       = 7
+	roleResponder    = 1
+	maxRecordContent = 65535
+	requestID        = 1 // One request per connection
+)
+
+// ResponseError is a non-2xx answer from FPM. FPM itself is reachable;
+// usually the status path isn't enabled in the pool (pm.status_path).
+type ResponseError struct {
+	Code int
+	Body string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("php-fpm responded %d: %s", e.Code, strings.TrimSpace(e.Body))
+}
+
+// dial connects to a TCP address (host:port) or a Unix socket path
+func dial(address string, timeout time.Duration) (net.Conn, error) {
+	network := "tcp"
+	if strings.HasPrefix(address, "unix:") {
+		network, address = "unix", strings.TrimPrefix(address, "unix:")
+	} else if strings.HasPrefix(address, "/") {
+		network = "unix"
+	}
+	return net.DialTimeout(network, address, timeout)
+}
+
+// get performs a FastCGI GET of scriptName?query and returns the response body
+func get(address, scriptName, query string, timeout time.Duration) ([]byte, error) {
+	conn, err := dial(address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// 1. Request: BEGIN_REQUEST, PARAMS, empty PARAMS, empty STDIN
+	var req bytes.Buffer
+	writeRecord(&req, typeBeginRequest, []byte{0, roleResponder, 0, 0, 0, 0, 0, 0})
+
+	uri := scriptName
+	if query != "" {
+		uri += "?" + query
+	}
+	params := encodeParams([][2]string{
+		{"GATEWAY_INTERFACE", "CGI/1.1"},
+		{"SERVER_SOFTWARE", "sentinel-agent"},
+		{"SERVER_PROTOCOL", "HTTP/1.1"},
+		{"REQUEST_METHOD", "GET"},
+		{"SCRIPT_NAME", scriptName},
+		{"SCRIPT_FILENAME", scriptName},
+		{"REQUEST_URI", uri},
+		{"QUERY_STRING", query},
+		{"REMOTE_ADDR", "127.0.0.1"},
+	})
+	for len(params) > 0 {
+		n := min(len(params), maxRecordContent)
+		writeRecord(&req, typeParams, params[:n])
+		params = params[n:]
+	}
+	writeRecord(&req, typeParams, nil)
+	writeRecord(&req, typeStdin, nil)
+
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+
+	// 2. Response: STDOUT/STDERR records until END_REQUEST
+	var stdout, stderr bytes.Buffer
+	r := bufio.NewReader(conn)
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("failed to read response: %v", err)
+		}
+		contentLen := int(binary.BigEndian.Uint16(header[4:6]))
+		content := make([]byte, contentLen+int(header[6])) // Content plus padding
+		if _, err := io.ReadFull(r, content); err != nil {
+			return nil, fmt.Errorf("failed to read response: %v", err)
+		}
+		content = content[:contentLen]
+
+		switch header[1] {
+		case typeStdout:
+			stdout.Write(content)
+		case typeStderr:
+			stderr.Write(content)
+		case typeEndRequest:
+			return parseCGIResponse(stdout.Bytes(), stderr.String())
+		}
+	}
+}
+
+func writeRecord(w *bytes.Buffer, recType byte, content []byte) {
+	padding := (8 - len(content)%8) % 8
+	w.Write([]byte{fcgiVersion, recType, 0, requestID})
+	binary.Write(w, binary.BigEndian, uint16(len(content)))
+	w.Write([]byte{byte(padding), 0})
+	w.Write(content)
+	w.Write(make([]byte, padding))
+}
+
+// encodeParams encodes name-value pairs; lengths over 127 take four bytes
+func encodeParams(pairs [][2]string) []byte {
+	var buf bytes.Buffer
+	writeLen := func(n int) {
+		if n < 128 {
+			buf.WriteByte(byte(n))
+			return
+		}
+		binary.Write(&buf, binary.BigEndian, uint32(n)|1<<31)
+	}
+	for _, p := range pairs {
+		writeLen(len(p[0]))
+		writeLen(len(p[1]))
+		buf.WriteString(p[0])
+		buf.WriteString(p[1])
+	}
+	return buf.Bytes()
+}
+
+// parseCGIResponse splits the CGI headers off and checks the Status header
+func parseCGIResponse(out []byte, stderr string) ([]byte, error) {
+	tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(out)))
+	headers, err := tp.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse response headers: %v", err)
+	}
+	body, _ := io.ReadAll(tp.R)
+
+	code := 200
+	if status := headers.Get("Status"); status != "" {
+		if fields := strings.Fields(status); len(fields) > 0 {
+			if c, err := strconv.Atoi(fields[0]); err == nil {
+				code = c
+			}
+		}
+	}
+	if code < 200 || code > 299 {
+		msg := string(body)
+		if msg == "" {
+			msg = stderr
+		}
+		return nil, &ResponseError{Code: code, Body: msg}
+	}
+	return body, nil
+}
@@ -0,0 +1,211 @@
+package fpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeParams reverses encodeParams the way FPM reads a PARAMS stream
+func decodeParams(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	readLen := func() int {
+		if len(data) == 0 {
+			t.Fatal("truncated params")
+		}
+		if data[0]>>7 == 0 {
+			n := int(data[0])
+			data = data[1:]
+			return n
+		}
+		if len(data) < 4 {
+			t.Fatal("truncated params length")
+		}
+		n := int(binary.BigEndian.Uint32(data) &^ (1 << 31))
+		data = data[4:]
+		return n
+	}
+
+	params := make(map[string]string)
+	for len(data) > 0 {
+		nameLen, valueLen := readLen(), readLen()
+		if len(data) < nameLen+valueLen {
+			t.Fatal("truncated params content")
+		}
+		params[string(data[:nameLen])] = string(data[nameLen : nameLen+valueLen])
+		data = data[nameLen+valueLen:]
+	}
+	return params
+}
+
+func TestEncodeParams(t *testing.T) {
+	long := strings.Repeat("v", 200)
+	got := encodeParams([][2]string{{"A", "bc"}, {"LONG", long}})
+
+	want := []byte{1, 2, 'A', 'b', 'c', 4, 0x80, 0, 0, 200, 'L', 'O', 'N', 'G'}
+	want = append(want, long...)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got % x, want % x", got, want)
+	}
+
+	params := decodeParams(t, got)
+	if params["A"] != "bc" || params["LONG"] != long {
+		t.Errorf("round trip got %v", params)
+	}
+}
+
+func TestWriteRecordPadding(t *testing.T) {
+	var buf bytes.Buffer
+	writeRecord(&buf, typeStdin, []byte("hello"))
+
+	want := []byte{fcgiVersion, typeStdin, 0, requestID, 0, 5, 3, 0, 'h', 'e', 'l', 'l', 'o', 0, 0, 0}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got % x, want % x", buf.Bytes(), want)
+	}
+}
+
+// request is what the fake FPM received on one connection
+type request struct {
+	params []byte // Raw PARAMS stream
+	err    error
+}
+
+// fakeFPM serves one FastCGI request on a Unix socket and answers with stdout,
+// split into records of at most chunk bytes, and stderr
+func fakeFPM(t *testing.T, stdout, stderr string, chunk int) (string, <-chan request) {
+	t.Helper()
+
+	address := filepath.Join(t.TempDir(), "fpm.sock")
+	ln, err := net.Listen("unix", address)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan request, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- request{err: err}
+			return
+		}
+		defer conn.Close()
+
+		// Read records until the empty STDIN that ends the request
+		var params []byte
+		header := make([]byte, 8)
+		for {
+			if _, err := io.ReadFull(conn, header); err != nil {
+				received <- request{err: err}
+				return
+			}
+			content := make([]byte, int(binary.BigEndian.Uint16(header[4:6]))+int(header[6]))
+			if _, err := io.ReadFull(conn, content); err != nil {
+				received <- request{err: err}
+				return
+			}
+			content = content[:binary.BigEndian.Uint16(header[4:6])]
+			if header[1] == typeParams {
+				params = append(params, content...)
+			}
+			if header[1] == typeStdin && len(content) == 0 {
+				break
+			}
+		}
+		received <- request{params: params}
+
+		var resp bytes.Buffer
+		if stderr != "" {
+			writeRecord(&resp, typeStderr, []byte(stderr))
+		}
+		for out := []byte(stdout); len(out) > 0; {
+			n := min(len(out), chunk)
+			writeRecord(&resp, typeStdout, out[:n])
+			out = out[n:]
+		}
+		writeRecord(&resp, typeStdout, nil)
+		writeRecord(&resp, typeEndRequest, make([]byte, 8))
+		conn.Write(resp.Bytes())
+	}()
+	return address, received
+}
+
+func TestGetRoundTrip(t *testing.T) {
+	body := `{"pool":"www"}`
+	address, received := fakeFPM(t, "Content-type: application/json\r\n\r\n"+body, "", 7)
+
+	got, err := get(address, "/status", "json&full", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != body {
+		t.Errorf("got body %q, want %q", got, body)
+	}
+
+	req := <-received
+	if req.err != nil {
+		t.Fatal(req.err)
+	}
+	params := decodeParams(t, req.params)
+	for name, want := range map[string]string{
+		"REQUEST_METHOD":  "GET",
+		"SCRIPT_NAME":     "/status",
+		"SCRIPT_FILENAME": "/status",
+		"REQUEST_URI":     "/status?json&full",
+		"QUERY_STRING":    "json&full",
+	} {
+		if params[name] != want {
+			t.Errorf("param %s: got %q, want %q", name, params[name], want)
+		}
+	}
+}
+
+func TestGetErrorStatus(t *testing.T) {
+	address, _ := fakeFPM(t, "Status: 404 Not Found\r\nContent-type: text/html\r\n\r\n", "Primary script unknown", 64)
+
+	_, err := get(address, "/status", "json", time.Second)
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) {
+		t.Fatalf("got %v, want a *ResponseError", err)
+	}
+	if respErr.Code != 404 {
+		t.Errorf("got code %d, want 404", respErr.Code)
+	}
+	// Without a body, the error carries what FPM wrote to stderr
+	if respErr.Body != "Primary script unknown" {
+		t.Errorf("got body %q", respErr.Body)
+	}
+}
+
+func TestClientStatus(t *testing.T) {
+	page := `{"pool":"www","process manager":"dynamic","active processes":1,"total processes":2,` +
+		`"processes":[{"pid":11,"state":"Running","request duration":2500000,"request method":"POST","request uri":"/checkout?step=2"},` +
+		`{"pid":12,"state":"Idle","request duration":1000,"request uri":"/status?json&full"}]}`
+	address, _ := fakeFPM(t, "Content-type: application/json\r\n\r\n"+page, "", maxRecordContent)
+
+	status, err := NewClient(address, "/status").Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Pool != "www" || status.ActiveProcesses != 1 || status.TotalProcesses != 2 || len(status.Workers) != 2 {
+		t.Fatalf("got %+v", status)
+	}
+
+	w := status.Workers[0]
+	if !w.Busy() || w.PID != 11 || w.RequestMethod != "POST" || w.RequestURI != "/checkout?step=2" {
+		t.Errorf("got worker %+v", w)
+	}
+	// FPM reports microseconds
+	if w.RequestDurationMS != 2500 {
+		t.Errorf("got %v ms, want 2500", w.RequestDurationMS)
+	}
+	if status.Workers[1].Busy() {
+		t.Error("idle worker reported busy")
+	}
+}
@@ -0,0 +1,142 @@
+package fpm
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Status is the pool status page in full mode (pm.status_path?json&full)
+type Status struct {
+	Pool               string   `json:"pool"`
+	ProcessManager     string   `json:"process_manager"`
+	StartSinceSeconds  int64    `json:"start_since_seconds"`
+	AcceptedConn       uint64   `json:"accepted_conn"`
+	ListenQueue        int      `json:"listen_queue"` // Connections waiting for a free worker
+	MaxListenQueue     int      `json:"max_listen_queue"`
+	ListenQueueLen     int      `json:"listen_queue_len"`
+	IdleProcesses      int      `json:"idle_processes"`
+	ActiveProcesses    int      `json:"active_processes"`
+	TotalProcesses     int      `json:"total_processes"`
+	MaxActiveProcesses int      `json:"max_active_processes"`
+	MaxChildrenReached int      `json:"max_children_reached"` // Times pm.max_children stopped a spawn
+	SlowRequests       int      `json:"slow_requests"`
+	Workers            []Worker `json:"workers"`
+}
+
+// Worker is one FPM process and the request it is serving (or served last, when idle)
+type Worker struct {
+	PID               int     `json:"pid"`
+	State             string  `json:"state"` // Idle, Running, Reading headers, Finishing...
+	StartSinceSeconds int64   `json:"start_since_seconds"`
+	Requests          uint64  `json:"requests"`
+	RequestDurationMS float64 `json:"request_duration_ms"` // So far, while Running
+	RequestMethod     string  `json:"request_method"`
+	RequestURI        string  `json:"request_uri"`
+	ContentLength     int64   `json:"content_length"`
+	User              string  `json:"user"`
+	Script            string  `json:"script"`
+	LastRequestCPU    float64 `json:"last_request_cpu"`
+	LastRequestMemory uint64  `json:"last_request_memory"`
+}
+
+// Busy reports whether the worker is in the middle of a request
+func (w Worker) Busy() bool {
+	return w.State != "Idle"
+}
+
+// Raw page, keyed the way FPM writes it
+type rawStatus struct {
+	Pool               string      `json:"pool"`
+	ProcessManager     string      `json:"process manager"`
+	StartSince         int64       `json:"start since"`
+	AcceptedConn       uint64      `json:"accepted conn"`
+	ListenQueue        int         `json:"listen queue"`
+	MaxListenQueue     int         `json:"max listen queue"`
+	ListenQueueLen     int         `json:"listen queue len"`
+	IdleProcesses      int         `json:"idle processes"`
+	ActiveProcesses    int         `json:"active processes"`
+	TotalProcesses     int         `json:"total processes"`
+	MaxActiveProcesses int         `json:"max active processes"`
+	MaxChildrenReached int         `json:"max children reached"`
+	SlowRequests       int         `json:"slow requests"`
+	Processes          []rawWorker `json:"processes"`
+}
+
+type rawWorker struct {
+	PID               int     `json:"pid"`
+	State             string  `json:"state"`
+	StartSince        int64   `json:"start since"`
+	Requests          uint64  `json:"requests"`
+	RequestDuration   float64 `json:"request duration"` // Microseconds
+	RequestMethod     string  `json:"request method"`
+	RequestURI        string  `json:"request uri"`
+	ContentLength     int64   `json:"content length"`
+	User              string  `json:"user"`
+	Script            string  `json:"script"`
+	LastRequestCPU    float64 `json:"last request cpu"`
+	LastRequestMemory uint64  `json:"last request memory"`
+}
+
+// Client queries the status page of one FPM pool over FastCGI
+type Client struct {
+	Address    string // host:port, or a Unix socket path
+	StatusPath string // pm.status_path of the pool
+	Timeout    time.Duration
+}
+
+func NewClient(address, statusPath string) *Client {
+	return &Client{
+		Address:    address,
+		StatusPath: statusPath,
+		Timeout:    500 * time.Millisecond,
+	}
+}
+
+// Status fetches the full status page. A *ResponseError means FPM answered
+// but the page isn't available; any other error means FPM is unreachable.
+func (c *Client) Status() (*Status, error) {
+	body, err := get(c.Address, c.StatusPath, "json&full", c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw rawStatus
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse status page: %v", err)
+	}
+
+	status := &Status{
+		Pool:               raw.Pool,
+		ProcessManager:     raw.ProcessManager,
+		StartSinceSeconds:  raw.StartSince,
+		AcceptedConn:       raw.AcceptedConn,
+		ListenQueue:        raw.ListenQueue,
+		MaxListenQueue:     raw.MaxListenQueue,
+		ListenQueueLen:     raw.ListenQueueLen,
+		IdleProcesses:      raw.IdleProcesses,
+		ActiveProcesses:    raw.ActiveProcesses,
+		TotalProcesses:     raw.TotalProcesses,
+		MaxActiveProcesses: raw.MaxActiveProcesses,
+		MaxChildrenReached: raw.MaxChildrenReached,
+		SlowRequests:       raw.SlowRequests,
+		Workers:            make([]Worker, 0, len(raw.Processes)),
+	}
+	for _, p := range raw.Processes {
+		status.Workers = append(status.Workers, Worker{
+			PID:               p.PID,
+			State:             p.State,
+			StartSinceSeconds: p.StartSince,
+			Requests:          p.Requests,
+			RequestDurationMS: p.RequestDuration / 1000,
+			RequestMethod:     p.RequestMethod,
+			RequestURI:        p.RequestURI,
+			ContentLength:     p.ContentLength,
+			User:              p.User,
+			Script:            p.Script,
+			LastRequestCPU:    p.LastRequestCPU,
+			LastRequestMemory: p.LastRequestMemory,
+		})
+	}
+	return status, nil
+}
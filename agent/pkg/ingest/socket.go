@@ -0,0 +1,60 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/mike/sentinel-agent/pkg/laravel"
+)
+
+// Large enough for an entry with 50 fingerprints and slow queries
+const maxDatagramSize = 256 * 1024
+
+// ListenSocket receives one JSON entry per datagram on a Unix socket.
+// Writers never block: if the agent is down the probe's send simply fails.
+func ListenSocket(ctx context.Context, path string, handle Handler) error {
+	if err := PrepareDir(path); err != nil {
+		return err
+	}
+
+	// A socket file left by a previous run would make bind fail
+	os.Remove(path)
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", path, err)
+	}
+	defer os.Remove(path)
+
+	// PHP-FPM usually runs as a different user, and sending a datagram needs
+	// write access to the socket. Any local user can then submit entries; they
+	// go through the same decoding and rate limit as the HTTP ingest endpoint,
+	// which is open to them as well.
+	os.Chmod(path, 0666)
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, _, err := conn.ReadFromUnix(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		var entry laravel.PerformanceEntry
+		if err := json.Unmarshal(buf[:n], &entry); err != nil {
+			fmt.Printf("[Socket] Invalid datagram: %v\n", err)
+			continue
+		}
+		handle(entry)
+	}
+}
@@ -0,0 +1,187 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/laravel"
+)
+
+const (
+	spoolPollInterval = time.Second
+
+	// A probe that opened the spool just before it was rotated still appends to
+	// the work file, so work files are re-read for this long before deletion
+	spoolSettleTime = 5 * time.Second
+)
+
+// Handler receives every decoded entry, whatever the transport
+type Handler func(laravel.PerformanceEntry)
+
+// workFile is a rotated spool still being drained
+type workFile struct {
+	path   string
+	offset int64     // Bytes already handled
+	since  time.Time // Rotation, or last change of a leftover
+}
+
+// TailSpool drains the NDJSON spool file the probe appends to.
+//
+// Each poll renames the spool to "<path>.<unix nanos>.work" and feeds the lines
+// appended since the last poll to handle. Once a work file has settled it is
+// read a last time under an exclusive lock, so no append is in flight, and
+// deleted. Work files left behind when the agent stops are replayed on start
+// from where it got to, so entries written while it was down are not lost.
+func TailSpool(ctx context.Context, path string, handle Handler) {
+	if err := PrepareDir(path); err != nil {
+		fmt.Printf("[Spool] %v\n", err)
+	}
+
+	// 1. Leftovers from a previous run
+	var pending []*workFile
+	leftovers, _ := filepath.Glob(path + ".*.work")
+	sort.Strings(leftovers)
+	for _, work := range leftovers {
+		w := &workFile{path: work, since: time.Now()}
+		if stat, err := os.Stat(work); err == nil {
+			w.since = stat.ModTime()
+		}
+		// Skip what was handled before the agent stopped
+		if data, err := os.ReadFile(w.offsetPath()); err == nil {
+			w.offset, _ = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		}
+		pending = append(pending, w)
+	}
+
+	ticker := time.NewTicker(spoolPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// 2. Swap the spool out; the probe creates a fresh one on its next write
+		if stat, err := os.Stat(path); err == nil && stat.Size() > 0 {
+			work := fmt.Sprintf("%s.%d.work", path, time.Now().UnixNano())
+			if err := os.Rename(path, work); err != nil {
+				fmt.Printf("[Spool] Failed to rotate %s: %v\n", path, err)
+			} else {
+				pending = append(pending, &workFile{path: work, since: time.Now()})
+			}
+		}
+
+		// 3. Drain new lines, deleting work files that have settled
+		kept := pending[:0]
+		for _, w := range pending {
+			if !w.drain(handle, time.Since(w.since) >= spoolSettleTime) {
+				kept = append(kept, w)
+			}
+		}
+		pending = kept
+
+		select {
+		case <-ctx.Done():
+			// Finish what was read, so a restart doesn't replay it
+			for _, w := range pending {
+				w.drain(handle, true)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PrepareDir creates the directory holding a spool or socket when it doesn't
+// exist, writable by every user so PHP workers can create files in it. The
+// sticky bit keeps users from deleting each other's files, while the agent,
+// owning the directory, can still rotate them.
+//
+// An existing directory is left as it is: for a custom spool_path or
+// socket_path, the operator grants the PHP user write access to it.
+func PrepareDir(path string) error {
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", dir, err)
+	}
+	// Set explicitly, MkdirAll is subject to the umask
+	if err := os.Chmod(dir, 0777|os.ModeSticky); err != nil {
+		return fmt.Errorf("failed to make %s writable: %v", dir, err)
+	}
+	return nil
+}
+
+// drain handles the lines appended since the last call. With final, it waits
+// for any writer holding the lock and deletes the file once read; it reports
+// whether the file is gone.
+func (w *workFile) drain(handle Handler, final bool) bool {
+	file, err := os.Open(w.path)
+	if os.IsNotExist(err) {
+		return true
+	}
+	if err != nil {
+		fmt.Printf("[Spool] Failed to open %s: %v\n", w.path, err)
+		return false
+	}
+	defer file.Close()
+
+	// The probe appends with LOCK_EX; wait for an in-flight write to finish
+	if final {
+		lockExclusive(file)
+	} else {
+		lockShared(file)
+	}
+
+	start := w.offset
+	if _, err := file.Seek(w.offset, io.SeekStart); err != nil {
+		fmt.Printf("[Spool] Failed reading %s: %v\n", w.path, err)
+		return false
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		// A line without its newline is still being written, unless this is the last read
+		if err == io.EOF && !final {
+			break
+		}
+		w.offset += int64(len(line))
+		if len(line) > 1 {
+			var entry laravel.PerformanceEntry
+			if json.Unmarshal(line, &entry) == nil {
+				handle(entry)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Printf("[Spool] Failed reading %s: %v\n", w.path, err)
+			return false
+		}
+	}
+
+	if !final {
+		if w.offset > start {
+			os.WriteFile(w.offsetPath(), []byte(strconv.FormatInt(w.offset, 10)), 0644)
+		}
+		return false
+	}
+	// Still holding the lock, so no probe can append between the read and the delete
+	os.Remove(w.path)
+	os.Remove(w.offsetPath())
+	return true
+}
+
+// offsetPath records how far a work file was handled, for replays after a restart
+func (w *workFile) offsetPath() string {
+	return w.path + ".offset"
+}
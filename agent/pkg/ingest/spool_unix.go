@@ -0,0 +1,18 @@
+//go:build !windows
+
+package ingest
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockShared waits for a probe holding LOCK_EX (file_put_contents with LOCK_EX) to finish its write
+func lockShared(file *os.File) {
+	syscall.Flock(int(file.Fd()), syscall.LOCK_SH)
+}
+
+// lockExclusive also waits for in-flight writes, and keeps new ones out until the file is closed
+func lockExclusive(file *os.File) {
+	syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package ingest
+
+import "os"
+
+// lockShared is a no-op: Windows has no flock, and PHP's LOCK_EX there is a
+// mandatory lock held only for the length of the write
+func lockShared(file *os.File) {}
+
+func lockExclusive(file *os.File) {}
@@ -6,61 +6,164 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/mike/sentinel-agent/pkg/config"
 )
 
 const InspectorFilename = "sentinel_inspector.php"
 
 // Injector manages the injection of the inspector script into PHP projects
 type Injector struct {
-	InspectorContent []byte
+	InspectorTemplate *template.Template
+}
+
+// ProbeSettings are the values rendered into the inspector template
+type ProbeSettings struct {
+	Transport       string
+	IngestURL       string
+	SpoolPath       string
+	SocketPath      string
+	TimeoutSeconds  float64
+	SlowQueryMS     float64
+	SampleRate      float64
+	MinDurationMS   float64
+	CaptureBindings bool
+	Traces          bool
 }
 
+// New parses the inspector template. It panics on a malformed template,
+// which can only happen if the embedded file is broken.
 func New(content []byte) *Injector {
+	tmpl := template.Must(template.New("inspector").Funcs(template.FuncMap{
+		"php": phpLiteral,
+	}).Parse(string(content)))
+
 	return &Injector{
-		InspectorContent: content,
+		InspectorTemplate: tmpl,
 	}
 }
 
-// EnableAudit injects require_once into public/index.php
-func (i *Injector) EnableAudit(projectPath string) error {
+// SettingsFor resolves the probe settings of a project from the agent config
+func SettingsFor(cfg *config.Config, projectPath string) ProbeSettings {
+	probe := cfg.ProbeFor(projectPath)
+	return ProbeSettings{
+		Transport:       probe.Transport,
+		IngestURL:       cfg.AgentURL() + "/projects/ingest",
+		SpoolPath:       cfg.SpoolPath,
+		SocketPath:      cfg.SocketPath,
+		TimeoutSeconds:  float64(probe.TimeoutMS) / 1000,
+		SlowQueryMS:     probe.SlowQueryMS,
+		SampleRate:      probe.SampleRate,
+		MinDurationMS:   probe.MinDurationMS,
+		CaptureBindings: probe.CaptureBindings,
+		Traces:          probe.Traces,
+	}
+}
+
+// Render produces the inspector PHP source for the given settings
+func (i *Injector) Render(settings ProbeSettings) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := i.InspectorTemplate.Execute(&buf, settings); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EnableAudit injects require_once into public/index.php and artisan
+func (i *Injector) EnableAudit(projectPath string, settings ProbeSettings) error {
 	publicDir := filepath.Join(projectPath, "public")
 	if _, err := os.Stat(publicDir); os.IsNotExist(err) {
 		publicDir = projectPath
 	}
 
 	// 1. Write the Inspector File Locally
+	content, err := i.Render(settings)
+	if err != nil {
+		return fmt.Errorf("failed to render inspector: %v", err)
+	}
 	localInspectorPath := filepath.Join(publicDir, InspectorFilename)
 	fmt.Printf("[Injector] Writing inspector to %s\n", localInspectorPath)
-	if err := os.WriteFile(localInspectorPath, i.InspectorContent, 0644); err != nil {
+	if err := os.WriteFile(localInspectorPath, content, 0644); err != nil {
 		return fmt.Errorf("failed to write local inspector: %v", err)
 	}
 
 	// 2. Modify index.php
 	indexPhpPath := filepath.Join(publicDir, "index.php")
-	content, err := os.ReadFile(indexPhpPath)
+	if err := injectHook(indexPhpPath, includeFor(publicDir, publicDir)); err != nil {
+		return err
+	}
+
+	// 3. Modify artisan so queue workers and commands report too
+	artisanPath := filepath.Join(projectPath, "artisan")
+	if _, err := os.Stat(artisanPath); err != nil {
+		return nil // Not every project ships artisan
+	}
+	return injectHook(artisanPath, includeFor(projectPath, publicDir))
+}
+
+// DisableAudit removes the injection from index.php and artisan
+func (i *Injector) DisableAudit(projectPath string) error {
+	publicDir := filepath.Join(projectPath, "public")
+	if _, err := os.Stat(publicDir); os.IsNotExist(err) {
+		publicDir = projectPath
+	}
+
+	// 1. Remove Local Inspector File
+	localInspectorPath := filepath.Join(publicDir, InspectorFilename)
+	os.Remove(localInspectorPath)
+
+	// 2. Clean index.php and artisan
+	revertHook(filepath.Join(publicDir, "index.php"), includeFor(publicDir, publicDir))
+	return revertHook(filepath.Join(projectPath, "artisan"), includeFor(projectPath, publicDir))
+}
+
+// Markers for the smart hook
+var (
+	// (require_once __DIR__.'/../bootstrap/app.php') in index.php,
+	// (require_once __DIR__.'/bootstrap/app.php') in the Laravel 11 artisan
+	bootstrapExprRe = regexp.MustCompile(`\(\s*require_once\s+__DIR__\s*\.\s*['"](?:/\.\.)?/bootstrap/app\.php['"]\s*\)`)
+
+	// $app = require_once __DIR__.'/bootstrap/app.php'; in older artisan files,
+	// $app = require_once __DIR__.'/../bootstrap/app.php'; in Laravel <= 10 index.php
+	bootstrapAssignRe = regexp.MustCompile(`\$app\s*=\s*require_once\s+__DIR__\s*\.\s*['"](?:/\.\.)?/bootstrap/app\.php['"]\s*;`)
+
+	smartHookRe = regexp.MustCompile(`\$__sentinel_app\s*=\s*(\(.*?require_once.*?\));\s*if\s*\(function_exists\('sentinel_bind'\)\)[\s\S]*?\}\s*\$__sentinel_app`)
+)
+
+const assignHook = "\nif (function_exists('sentinel_bind')) { sentinel_bind($app); }"
+
+// includeFor builds the include statement for a file in dir
+func includeFor(dir, publicDir string) string {
+	rel, err := filepath.Rel(dir, filepath.Join(publicDir, InspectorFilename))
 	if err != nil {
-		return fmt.Errorf("failed to read index.php: %v", err)
+		rel = InspectorFilename
+	}
+	return fmt.Sprintf("include_once __DIR__.'/%s';", filepath.ToSlash(rel))
+}
+
+// injectHook adds the include and the sentinel_bind hook to a PHP entry point
+func injectHook(path, injectionInclude string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", filepath.Base(path), err)
 	}
 
 	// Check if already injected
-	injectionInclude := fmt.Sprintf("include_once __DIR__.'/%s';", InspectorFilename)
 	if bytes.Contains(content, []byte(injectionInclude)) {
-		fmt.Println("[Injector] Already injected.")
+		fmt.Printf("[Injector] Already injected into %s.\n", filepath.Base(path))
 		return nil // Already active
 	}
 
-	// 3. Prepare Injections
 	// A. Basic Include at top
 	newContent := bytes.Replace(content, []byte("<?php"), []byte("<?php\n"+injectionInclude), 1)
 
 	// B. Smart Hook for Laravel 11/Modern Pattern
-	// Regex: Match (require_once ... bootstrap/app.php ... )
 	// We handle the surrounding parens carefully.
-	re := regexp.MustCompile(`\(\s*require_once\s+__DIR__\s*\.\s*['"]/../bootstrap/app\.php['"]\s*\)`)
-
-	match := re.Find(newContent)
-	if match != nil {
-		fmt.Println("[Injector] Regex MATCHED! Applying Smart Hook.")
+	if match := bootstrapExprRe.Find(newContent); match != nil {
+		fmt.Printf("[Injector] Regex MATCHED in %s! Applying Smart Hook.\n", filepath.Base(path))
 
 		// matchedStr is (require_once ... )
 		matchedStr := string(match)
@@ -71,34 +174,27 @@ if (function_exists('sentinel_bind')) { sentinel_bind($__sentinel_app); }
 $__sentinel_app`, matchedStr)
 
 		newContent = bytes.Replace(newContent, match, []byte(replacement), 1)
+	} else if loc := bootstrapAssignRe.FindIndex(newContent); loc != nil {
+		// C. Classic Pattern: hook right after the assignment
+		fmt.Printf("[Injector] Regex MATCHED in %s! Applying Assignment Hook.\n", filepath.Base(path))
+
+		hooked := append([]byte{}, newContent[:loc[1]]...)
+		hooked = append(hooked, assignHook...)
+		newContent = append(hooked, newContent[loc[1]:]...)
 	} else {
-		fmt.Println("[Injector] Regex FAILED to match bootstrap pattern.")
+		fmt.Printf("[Injector] Regex FAILED to match bootstrap pattern in %s.\n", filepath.Base(path))
 	}
 
-	return os.WriteFile(indexPhpPath, newContent, 0644)
+	return os.WriteFile(path, newContent, 0644)
 }
 
-// DisableAudit removes the injection from index.php
-func (i *Injector) DisableAudit(projectPath string) error {
-	publicDir := filepath.Join(projectPath, "public")
-	if _, err := os.Stat(publicDir); os.IsNotExist(err) {
-		publicDir = projectPath
-	}
-
-	// 1. Remove Local Inspector File
-	localInspectorPath := filepath.Join(publicDir, InspectorFilename)
-	os.Remove(localInspectorPath)
-
-	// 2. Clean index.php
-	indexPhpPath := filepath.Join(publicDir, "index.php")
-	content, err := os.ReadFile(indexPhpPath)
+// revertHook removes everything injectHook added
+func revertHook(path, injectionInclude string) error {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return nil // Missing index.php? ignore
+		return nil // Missing file? ignore
 	}
 
-	// Define markers
-	injectionInclude := fmt.Sprintf("include_once __DIR__.'/%s';", InspectorFilename)
-
 	// A. Remove Top Include
 	newContent := bytes.Replace(content, []byte("\n"+injectionInclude), []byte(""), -1)
 	newContent = bytes.Replace(newContent, []byte(injectionInclude), []byte(""), -1)
@@ -108,14 +204,39 @@ func (i *Injector) DisableAudit(projectPath string) error {
 	// if (function_exists('sentinel_bind')) ...
 	// $__sentinel_app
 	// We use a strict pattern to match exactly what we injected, preventing partial matches.
-	re := regexp.MustCompile(`\$__sentinel_app\s*=\s*(\(.*?require_once.*?\));\s*if\s*\(function_exists\('sentinel_bind'\)\)[\s\S]*?\}\s*\$__sentinel_app`)
-
-	if loc := re.FindSubmatchIndex(newContent); loc != nil {
+	if loc := smartHookRe.FindSubmatchIndex(newContent); loc != nil {
 		// loc[2] and loc[3] are the capture group indices (original bootstrap)
 		originalBootstrap := newContent[loc[2]:loc[3]]
 		newContent = bytes.Replace(newContent, newContent[loc[0]:loc[1]], originalBootstrap, 1)
-		fmt.Println("[Injector] Reverted Smart Hook.")
+		fmt.Printf("[Injector] Reverted Smart Hook in %s.\n", filepath.Base(path))
 	}
 
-	return os.WriteFile(indexPhpPath, newContent, 0644)
+	// C. Revert Assignment Hook
+	newContent = bytes.Replace(newContent, []byte(assignHook), []byte(""), -1)
+
+	if bytes.Equal(content, newContent) {
+		return nil
+	}
+	return os.WriteFile(path, newContent, 0644)
+}
+
+// phpLiteral renders a Go value as a PHP literal
+func phpLiteral(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		escaped := strings.ReplaceAll(val, `\`, `\\`)
+		escaped = strings.ReplaceAll(escaped, `'`, `\'`)
+		return "'" + escaped + "'"
+	case bool:
+		if val {
+			return "true"
+		}
+		return "false"
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(val)
+	default:
+		return "null"
+	}
 }
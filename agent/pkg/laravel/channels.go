@@ -0,0 +1,244 @@
+package laravel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AllChannels merges every discovered channel by timestamp
+const AllChannels = "all"
+
+// LogChannel groups the files written by one logging channel.
+// Daily channels produce one file per day ("laravel-2026-10-16.log").
+type LogChannel struct {
+	Name       string   `json:"name"`                  // File stem, e.g. "laravel" or "payments"
+	ConfigName string   `json:"config_name,omitempty"` // Channel key in config/logging.php
+	Driver     string   `json:"driver,omitempty"`      // single, daily, ...
+	Files      []string `json:"files"`                 // Least recently written first
+}
+
+// Current returns the file the channel is writing to now
+func (c LogChannel) Current() string {
+	return c.Files[len(c.Files)-1]
+}
+
+// ConfiguredChannel is an entry of config('logging.channels')
+type ConfiguredChannel struct {
+	Driver string `json:"driver"`
+	Path   string `json:"path"`
+}
+
+var dailySuffixRe = regexp.MustCompile(`-\d{4}-\d{2}-\d{2}$`)
+
+// DiscoverChannels lists the log files under storage/logs grouped by channel
+func DiscoverChannels(projectPath string) ([]LogChannel, error) {
+	files, err := filepath.Glob(filepath.Join(projectPath, "storage", "logs", "*.log"))
+	if err != nil {
+		return nil, err
+	}
+	return groupChannels(files), nil
+}
+
+// DiscoverConfiguredChannels is DiscoverChannels enriched with config/logging.php,
+// including channels whose files live outside storage/logs.
+func DiscoverConfiguredChannels(projectPath string) ([]LogChannel, error) {
+	configured, err := GetConfiguredChannels(projectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(projectPath, "storage", "logs", "*.log"))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, f := range files {
+		seen[f] = true
+	}
+	for _, ch := range configured {
+		if ch.Path == "" {
+			continue
+		}
+		// Daily channels write "<stem>-YYYY-MM-DD.log" next to the configured path
+		stem := strings.TrimSuffix(ch.Path, filepath.Ext(ch.Path))
+		for _, m := range channelFiles(stem) {
+			if !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+
+	channels := groupChannels(files)
+	for i := range channels {
+		for name, ch := range configured {
+			if ch.Path != "" && channelName(ch.Path) == channels[i].Name {
+				channels[i].ConfigName = name
+				channels[i].Driver = ch.Driver
+				break
+			}
+		}
+	}
+	return channels, nil
+}
+
+// GetConfiguredChannels reads config('logging.channels') via artisan tinker
+func GetConfiguredChannels(projectPath string) (map[string]ConfiguredChannel, error) {
+	cmd := exec.Command("php", "artisan", "tinker", "--execute", "echo json_encode(config('logging.channels'));")
+	cmd.Dir = projectPath
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run artisan command: %v", err)
+	}
+
+	// Skip any banner text before the JSON document
+	if idx := strings.IndexByte(string(output), '{'); idx > 0 {
+		output = output[idx:]
+	}
+
+	var channels map[string]ConfiguredChannel
+	if err := json.Unmarshal(output, &channels); err != nil {
+		return nil, fmt.Errorf("failed to parse logging config: %v", err)
+	}
+	return channels, nil
+}
+
+// GetAppTimezone reads config('app.timezone') via artisan tinker. Laravel writes
+// log timestamps in that zone, without an offset.
+func GetAppTimezone(projectPath string) (*time.Location, error) {
+	cmd := exec.Command("php", "artisan", "tinker", "--execute", "echo config('app.timezone');")
+	cmd.Dir = projectPath
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run artisan command: %v", err)
+	}
+
+	// The zone is the last line, after any banner text
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	name := strings.TrimSpace(lines[len(lines)-1])
+	if name == "" {
+		return nil, fmt.Errorf("app timezone is not set")
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown app timezone %q: %v", name, err)
+	}
+	return loc, nil
+}
+
+// ResolveLogFiles maps a channel selector to the files to read.
+// "" is the default laravel log, "all" is the current file of every channel
+// under storage/logs. A channel missing from storage/logs is looked up in
+// config/logging.php, which needs artisan.
+func ResolveLogFiles(projectPath, channel string) ([]string, error) {
+	if channel == "" {
+		return []string{CurrentLogFile(projectPath)}, nil
+	}
+
+	channels, err := DiscoverChannels(projectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, ch := range channels {
+		if channel == AllChannels || ch.Name == channel {
+			files = append(files, ch.Current())
+		}
+	}
+	if len(files) > 0 || channel == AllChannels {
+		return files, nil
+	}
+
+	// Configured channels can write outside storage/logs
+	if configured, err := DiscoverConfiguredChannels(projectPath); err == nil {
+		for _, ch := range configured {
+			if ch.Name == channel {
+				files = append(files, ch.Current())
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("unknown log channel: %s", channel)
+	}
+	return files, nil
+}
+
+func groupChannels(files []string) []LogChannel {
+	// By modification time, so Current() is the file written last even when a
+	// project switched from single to daily and kept its old "laravel.log"
+	sortByModTime(files)
+
+	index := make(map[string]int)
+	var channels []LogChannel
+	for _, f := range files {
+		name := channelName(f)
+		i, ok := index[name]
+		if !ok {
+			i = len(channels)
+			index[name] = i
+			channels = append(channels, LogChannel{Name: name})
+		}
+		channels[i].Files = append(channels[i].Files, f)
+	}
+
+	return channels
+}
+
+// channelFiles returns "<stem>.log" and the "<stem>-YYYY-MM-DD.log" files of a
+// daily channel, but not other channels sharing the prefix ("laravel-worker.log")
+func channelFiles(stem string) []string {
+	matches, _ := filepath.Glob(stem + "*.log")
+
+	name := filepath.Base(stem)
+	files := matches[:0]
+	for _, m := range matches {
+		if channelName(m) == name {
+			files = append(files, m)
+		}
+	}
+	return files
+}
+
+// newestFile returns the most recently modified of files, "" if there are none
+func newestFile(files []string) string {
+	if len(files) == 0 {
+		return ""
+	}
+	sorted := append([]string(nil), files...)
+	sortByModTime(sorted)
+	return sorted[len(sorted)-1]
+}
+
+// sortByModTime orders files least recently modified first. Ties keep name
+// order, where the date suffix of daily files sorts chronologically.
+func sortByModTime(files []string) {
+	modTimes := make(map[string]time.Time, len(files))
+	for _, f := range files {
+		if stat, err := os.Stat(f); err == nil {
+			modTimes[f] = stat.ModTime()
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		a, b := modTimes[files[i]], modTimes[files[j]]
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return files[i] < files[j]
+	})
+}
+
+func channelName(path string) string {
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return dailySuffixRe.ReplaceAllString(stem, "")
+}
@@ -1,92 +1,179 @@
 package laravel
 
 import (
-	"bufio"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/tail"
 )
 
-// GetRecentLogs reads the last N lines of storage/logs/laravel.log
-func GetRecentLogs(projectPath string, linesToRead int) ([]string, error) {
-	logPath := filepath.Join(projectPath, "storage", "logs", "laravel.log")
+// GetRecentLogs reads the last N lines of the channel's log file.
+// With several files (channel "all") lines are merged entry by entry in timestamp order.
+func GetRecentLogs(projectPath, channel string, linesToRead int) ([]string, error) {
+	files, err := ResolveLogFiles(projectPath, channel)
+	if err != nil {
+		return nil, err
+	}
 
-	file, err := os.Open(logPath)
-	if os.IsNotExist(err) {
-		return []string{"Log file not found (" + logPath + ")"}, nil
+	if len(files) == 1 {
+		// Reads backward from the end, so only the tail of large files is touched
+		lines, err := tail.LastLines(files[0], linesToRead)
+		if os.IsNotExist(err) {
+			return []string{"Log file not found (" + files[0] + ")"}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return lines, nil
 	}
+
+	entries, err := readEntries(files, linesToRead)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	// Simple approach: Read all lines, keep last N.
-	// For very large files, a seek-from-end approach would be better,
-	// but for local dev logs this is usually sufficient.
-	scanner := bufio.NewScanner(file)
-	var lines []string
-
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+	lines := []string{}
+	for _, entry := range entries {
+		lines = append(lines, strings.Split(entry.Raw, "\n")...)
+	}
+	if len(lines) > linesToRead {
+		lines = lines[len(lines)-linesToRead:]
 	}
+	return lines, nil
+}
 
-	if err := scanner.Err(); err != nil {
+// GetRecentEntries returns the last N parsed entries of the channel's log file(s)
+func GetRecentEntries(projectPath, channel string, limit int) ([]LogEntry, error) {
+	files, err := ResolveLogFiles(projectPath, channel)
+	if err != nil {
 		return nil, err
 	}
+	return readEntries(files, limit)
+}
 
-	total := len(lines)
-	if total <= linesToRead {
-		return lines, nil
+func readEntries(files []string, limit int) ([]LogEntry, error) {
+	entries := []LogEntry{}
+	for _, file := range files {
+		lines, err := tail.LastEntries(file, limit, IsLogHeader)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := channelName(file)
+		for _, entry := range ParseLogLines(lines) {
+			entry.Channel = name
+			entries = append(entries, entry)
+		}
+	}
+
+	// Timestamps are "Y-m-d H:i:s", so string order is chronological
+	if len(files) > 1 {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].Timestamp < entries[j].Timestamp
+		})
 	}
 
-	return lines[total-linesToRead:], nil
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
 }
 
 type PerformanceEntry struct {
+	Project     string      `json:"project"` // Project root, sent by the inspector
 	Method      string      `json:"method"`
 	URI         string      `json:"uri"`
+	Status      int         `json:"status,omitempty"` // HTTP response code, 0 if unknown
 	DurationMS  float64     `json:"duration_ms"`
 	MemoryMB    float64     `json:"memory_mb"`
 	QueryCount  int         `json:"query_count"`
 	SlowQueries []SlowQuery `json:"slow_queries"`
-	Timestamp   string      `json:"timestamp"` // Extracted from log line prefix if possible
+	Timestamp   string      `json:"timestamp"`               // Extracted from log line prefix if possible
+	StartUnixMS float64     `json:"start_unix_ms,omitempty"` // Epoch start from the probe, 0 from older probes
+
+	// Captured from RequestHandled by the inspector
+	RouteName string `json:"route_name,omitempty"`
+	Action    string `json:"action,omitempty"` // Controller@method or "Closure"
+	UserID    string `json:"user_id,omitempty"`
+	Exception string `json:"exception,omitempty"` // "Class: message"; also set for failed jobs
+
+	QueryFingerprints []QueryFingerprint `json:"query_fingerprints,omitempty"`
+	NPlusOne          []QueryFingerprint `json:"n_plus_one,omitempty"` // Flagged by the agent on ingest
+
+	// Span tree when the probe traces requests. The agent moves spans to its
+	// trace store on ingest, so stored entries only keep the id.
+	TraceID string `json:"trace_id,omitempty"`
+	Spans   []Span `json:"spans,omitempty"`
+
+	// Queue jobs and artisan commands (see the Kind* constants)
+	Kind       string `json:"kind,omitempty"` // Empty for HTTP requests
+	Name       string `json:"name,omitempty"` // Job class or command name
+	Queue      string `json:"queue,omitempty"`
+	Connection string `json:"connection,omitempty"`
+	Attempts   int    `json:"attempts,omitempty"`
+	Failed     bool   `json:"failed,omitempty"`
+	ExitCode   int    `json:"exit_code,omitempty"`
+}
+
+// Entry kinds reported by the inspector
+const (
+	KindRequest = "request"
+	KindJob     = "job"
+	KindCommand = "command"
+)
+
+// EntryKind returns the kind of an entry, defaulting to KindRequest
+func (e PerformanceEntry) EntryKind() string {
+	if e.Kind == "" {
+		return KindRequest
+	}
+	return e.Kind
+}
+
+// Span is one timed section of a traced request
+type Span struct {
+	ID         string                 `json:"id"`
+	ParentID   string                 `json:"parent_id,omitempty"` // Empty for the root span
+	Name       string                 `json:"name"`
+	Kind       string                 `json:"kind"`        // request, bootstrap, middleware, controller, db, cache, http, view
+	StartMS    float64                `json:"start_ms"`    // Offset from the start of the request
+	DurationMS float64                `json:"duration_ms"` // 0 for point events (cache, view)
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
 }
 
 type SlowQuery struct {
-	SQL        string  `json:"sql"`
-	DurationMS float64 `json:"duration_ms"`
+	SQL        string        `json:"sql"`
+	DurationMS float64       `json:"duration_ms"`
+	Bindings   []interface{} `json:"bindings,omitempty"` // Only when the probe captures bindings
+}
+
+// QueryFingerprint is a normalized query (bindings stripped) and how often it ran in one request
+type QueryFingerprint struct {
+	SQL     string  `json:"sql"`
+	Count   int     `json:"count"`
+	TotalMS float64 `json:"total_ms"`
 }
 
 // GetPerformanceLogs scans the log file for [SENTINEL_PERF] entries
-func GetPerformanceLogs(projectPath string) ([]PerformanceEntry, error) {
-	// Reuse GetRecentLogs logic but scan for specific tag
-	lines, err := GetRecentLogs(projectPath, 2000) // Scan last 2000 lines
+func GetPerformanceLogs(projectPath, channel string) ([]PerformanceEntry, error) {
+	entries, err := GetRecentEntries(projectPath, channel, 2000) // Scan last 2000 entries
 	if err != nil {
 		return nil, err
 	}
 
 	var metrics []PerformanceEntry
-	for _, line := range lines {
-		if idx := strings.Index(line, "[SENTINEL_PERF]"); idx != -1 {
-			// Extract JSON part: "[SENTINEL_PERF] {...}"
-			// The part after tag is often the JSON.
-			// Sometimes finding the first '{' after the tag is safer.
-			jsonPartIdx := strings.Index(line[idx:], "{")
-			if jsonPartIdx == -1 {
-				continue
-			}
-			jsonStr := line[idx+jsonPartIdx:]
-
-			var entry PerformanceEntry
-			if err := json.Unmarshal([]byte(jsonStr), &entry); err == nil {
-				// Try to extract timestamp from the beginning of the line
-				// Example: "[2024-01-01 12:00:00] local.INFO: [SENTINEL_PERF] ..."
-				if len(line) > 21 && line[0] == '[' && line[20] == ']' {
-					entry.Timestamp = line[1:20]
-				}
-				metrics = append(metrics, entry)
-			}
+	for _, logEntry := range entries {
+		if entry, ok := parsePerformanceEntry(logEntry); ok {
+			entry.Project = projectPath
+			metrics = append(metrics, entry)
 		}
 	}
 
@@ -95,36 +182,117 @@ func GetPerformanceLogs(projectPath string) ([]PerformanceEntry, error) {
 	return metrics, nil
 }
 
+func parsePerformanceEntry(logEntry LogEntry) (PerformanceEntry, bool) {
+	// Only the header line can carry the tag
+	line := logEntry.Raw
+	if nl := strings.IndexByte(line, '\n'); nl != -1 {
+		line = line[:nl]
+	}
+
+	idx := strings.Index(line, "[SENTINEL_PERF]")
+	if idx == -1 {
+		return PerformanceEntry{}, false
+	}
+
+	// Extract JSON part: "[SENTINEL_PERF] {...}"
+	// Decode only the first value so the trailing Monolog "[]" is ignored.
+	jsonPartIdx := strings.Index(line[idx:], "{")
+	if jsonPartIdx == -1 {
+		return PerformanceEntry{}, false
+	}
+
+	var entry PerformanceEntry
+	if err := json.NewDecoder(strings.NewReader(line[idx+jsonPartIdx:])).Decode(&entry); err != nil {
+		return PerformanceEntry{}, false
+	}
+	entry.Timestamp = logEntry.Timestamp
+	return entry, true
+}
+
 type DeadlockEntry struct {
-	Timestamp string `json:"timestamp"`
-	Message   string `json:"message"`
+	Timestamp string    `json:"timestamp"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"-"` // Timestamp in the log's zone; set by GetDeadlocksSince
 }
 
 // GetDeadlocks scans for database lock errors
-func GetDeadlocks(projectPath string) ([]DeadlockEntry, error) {
-	lines, err := GetRecentLogs(projectPath, 5000) // Look back further for errors
+func GetDeadlocks(projectPath, channel string) ([]DeadlockEntry, error) {
+	entries, err := GetRecentEntries(projectPath, channel, 5000) // Look back further for errors
 	if err != nil {
 		return nil, err
 	}
 
 	var deadlocks []DeadlockEntry
-	for _, line := range lines {
-		// Check for MySQL/Postgres deadlock keywords
-		if strings.Contains(line, "Deadlock found") || strings.Contains(line, "Lock wait timeout exceeded") {
-			entry := DeadlockEntry{
-				Message: line,
+	for _, entry := range entries {
+		if isDeadlock(entry) {
+			deadlocks = append(deadlocks, DeadlockEntry{
+				Timestamp: entry.Timestamp,
+				Message:   entry.Message,
+			})
+		}
+	}
+
+	return deadlocks, nil
+}
+
+// GetDeadlocksSince scans the default channel backward for lock errors logged
+// since the given time, oldest first. Log timestamps without an offset are read
+// in loc, the app's timezone. Every file written since then is scanned, so a
+// window crossing midnight also covers the previous daily file.
+func GetDeadlocksSince(projectPath string, since time.Time, loc *time.Location) ([]DeadlockEntry, error) {
+	files := channelFiles(filepath.Join(projectPath, "storage", "logs", "laravel"))
+	sortByModTime(files)
+
+	var deadlocks []DeadlockEntry // Newest first
+	for n := len(files) - 1; n >= 0; n-- {
+		if stat, err := os.Stat(files[n]); err != nil || stat.ModTime().Before(since) {
+			break // Written to before the window, like every older file
+		}
+
+		var lines []string // Current entry, newest line first
+		err := tail.Backward(files[n], func(line string) bool {
+			lines = append(lines, line)
+			if !IsLogHeader(line) {
+				return true
+			}
+
+			for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+				lines[i], lines[j] = lines[j], lines[i]
 			}
-			// Extract timestamp [2024-...]
-			if len(line) > 21 && line[0] == '[' && line[20] == ']' {
-				entry.Timestamp = line[1:20]
-				// Clean up message to remove timestamp/env parts if possible
-				if len(line) > 22 {
-					entry.Message = strings.TrimSpace(line[22:])
-				}
+			entries := ParseLogLines(lines)
+			lines = nil
+			if len(entries) == 0 {
+				return true
 			}
-			deadlocks = append(deadlocks, entry)
+			at, ok := entries[0].Time(loc)
+			if !ok {
+				return true
+			}
+			if at.Before(since) {
+				return false
+			}
+			if isDeadlock(entries[0]) {
+				deadlocks = append(deadlocks, DeadlockEntry{Timestamp: entries[0].Timestamp, Message: entries[0].Message, Time: at})
+			}
+			return true
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
 		}
 	}
 
+	for i, j := 0, len(deadlocks)-1; i < j; i, j = i+1, j-1 {
+		deadlocks[i], deadlocks[j] = deadlocks[j], deadlocks[i]
+	}
 	return deadlocks, nil
 }
+
+func isDeadlock(entry LogEntry) bool {
+	// Check for MySQL/Postgres deadlock keywords
+	for _, text := range []string{entry.Message, fmt.Sprint(entry.Context["exception"])} {
+		if strings.Contains(text, "Deadlock found") || strings.Contains(text, "Lock wait timeout exceeded") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package laravel
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	numericSegmentRe = regexp.MustCompile(`^\d+$`)
+	uuidSegmentRe    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hashSegmentRe    = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+	routeParamRe     = regexp.MustCompile(`^\{(\w+)(\?)?\}$`)
+)
+
+// RouteMatcher maps request URIs back to the route definitions from route:list
+type RouteMatcher struct {
+	routes []compiledRoute
+}
+
+type compiledRoute struct {
+	methods []string
+	uri     string // Normalised with a leading slash, e.g. "/users/{user}"
+	re      *regexp.Regexp
+	params  int
+}
+
+func NewRouteMatcher(routes []Route) *RouteMatcher {
+	m := &RouteMatcher{}
+	for _, r := range routes {
+		re, params := compileRoute(r.Uri)
+		m.routes = append(m.routes, compiledRoute{
+			methods: strings.Split(r.Method, "|"),
+			uri:     "/" + strings.Trim(r.Uri, "/"),
+			re:      re,
+			params:  params,
+		})
+	}
+
+	// Static routes win over parameterised ones ("users/create" before "users/{user}")
+	sort.SliceStable(m.routes, func(i, j int) bool { return m.routes[i].params < m.routes[j].params })
+	return m
+}
+
+// Match returns the route pattern serving method + uri
+func (m *RouteMatcher) Match(method, uri string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	path := "/" + strings.Trim(stripQuery(uri), "/")
+	for _, r := range m.routes {
+		if !containsFold(r.methods, method) {
+			continue
+		}
+		if r.re.MatchString(path) {
+			return r.uri, true
+		}
+	}
+	return "", false
+}
+
+// Normalize returns the matching route pattern, falling back to NormalizeURI
+func (m *RouteMatcher) Normalize(method, uri string) string {
+	if route, ok := m.Match(method, uri); ok {
+		return route
+	}
+	return NormalizeURI(uri)
+}
+
+// NormalizeURI collapses ids, UUIDs and hashes in a path ("/users/123" -> "/users/{id}")
+// for requests that don't match a known route.
+func NormalizeURI(uri string) string {
+	segments := strings.Split(strings.Trim(stripQuery(uri), "/"), "/")
+	for i, seg := range segments {
+		switch {
+		case numericSegmentRe.MatchString(seg):
+			segments[i] = "{id}"
+		case uuidSegmentRe.MatchString(seg):
+			segments[i] = "{uuid}"
+		case hashSegmentRe.MatchString(seg):
+			segments[i] = "{hash}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func compileRoute(uri string) (*regexp.Regexp, int) {
+	var pattern strings.Builder
+	params := 0
+
+	for _, seg := range strings.Split(strings.Trim(uri, "/"), "/") {
+		if seg == "" {
+			continue
+		}
+		if m := routeParamRe.FindStringSubmatch(seg); m != nil {
+			params++
+			if m[2] == "?" {
+				pattern.WriteString(`(?:/[^/]+)?`)
+			} else {
+				pattern.WriteString(`/[^/]+`)
+			}
+			continue
+		}
+		pattern.WriteString("/" + regexp.QuoteMeta(seg))
+	}
+
+	expr := pattern.String()
+	if expr == "" {
+		expr = "/"
+	}
+	return regexp.MustCompile("^" + expr + "$"), params
+}
+
+func stripQuery(uri string) string {
+	if idx := strings.IndexByte(uri, '?'); idx != -1 {
+		return uri[:idx]
+	}
+	return uri
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package laravel
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LogEntry is a single Monolog record, with any continuation lines
+// (stack traces, multi-line messages) attached to it.
+type LogEntry struct {
+	Timestamp   string                 `json:"timestamp"`
+	Environment string                 `json:"environment"`
+	Level       string                 `json:"level"`
+	Message     string                 `json:"message"`
+	Context     map[string]interface{} `json:"context,omitempty"`
+	StackTrace  []string               `json:"stack_trace,omitempty"`
+	Raw         string                 `json:"raw"`
+	Channel     string                 `json:"channel,omitempty"` // Source file stem, set when reading
+}
+
+// Matches "[2024-01-01 12:00:00] local.ERROR: message"
+// Also accepts the ISO 8601 variant with fractions and timezone offset.
+var logHeaderRe = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?)\] ([\w-]+)\.([A-Za-z]+): ?(.*)$`)
+
+const stackTraceMarker = "[stacktrace]"
+
+// IsLogHeader reports whether the line starts a new Monolog record
+func IsLogHeader(line string) bool {
+	return len(line) > 21 && line[0] == '[' && logHeaderRe.MatchString(line)
+}
+
+// ParseLogLines groups raw log lines into entries.
+// Lines before the first header (e.g. the tail of a truncated stack trace) are dropped.
+func ParseLogLines(lines []string) []LogEntry {
+	var entries []LogEntry
+	var header string
+	var continuation []string
+	inEntry := false
+
+	flush := func() {
+		if inEntry {
+			if entry, ok := parseEntry(header, continuation); ok {
+				entries = append(entries, entry)
+			}
+		}
+		continuation = nil
+	}
+
+	for _, line := range lines {
+		if IsLogHeader(line) {
+			flush()
+			header = line
+			inEntry = true
+			continue
+		}
+		if inEntry {
+			continuation = append(continuation, line)
+		}
+	}
+	flush()
+
+	return entries
+}
+
+func parseEntry(header string, continuation []string) (LogEntry, bool) {
+	m := logHeaderRe.FindStringSubmatch(header)
+	if m == nil {
+		return LogEntry{}, false
+	}
+
+	raw := header
+	if len(continuation) > 0 {
+		raw += "\n" + strings.Join(continuation, "\n")
+	}
+
+	entry := LogEntry{
+		Timestamp:   normalizeTimestamp(m[1]),
+		Environment: m[2],
+		Level:       strings.ToUpper(m[3]),
+		Raw:         raw,
+	}
+
+	// Body is everything after "env.LEVEL: ", including continuation lines
+	body := m[4]
+	if len(continuation) > 0 {
+		body += "\n" + strings.Join(continuation, "\n")
+	}
+
+	message, context := splitContext(body)
+	entry.Message = message
+	entry.Context = context
+
+	// Laravel embeds the trace inside the "exception" context string.
+	// Pull it out so the context stays readable.
+	if exc, ok := context["exception"].(string); ok {
+		if idx := strings.Index(exc, stackTraceMarker); idx != -1 {
+			entry.StackTrace = splitTrace(exc[idx+len(stackTraceMarker):])
+			context["exception"] = strings.TrimSpace(exc[:idx])
+		}
+	}
+
+	// Context could not be decoded: treat continuation lines as the trace
+	if context == nil && len(continuation) > 0 {
+		lines := continuation
+		for i, l := range lines {
+			if strings.TrimSpace(l) == stackTraceMarker {
+				lines = lines[i+1:]
+				break
+			}
+		}
+		entry.StackTrace = splitTrace(strings.Join(lines, "\n"))
+		entry.Message, entry.Context = splitContext(m[4])
+	}
+
+	return entry, true
+}
+
+// splitContext separates the message from the trailing "{context} [extra]" JSON
+func splitContext(body string) (string, map[string]interface{}) {
+	trimmed := stripEmptyArrays(body)
+	if !strings.HasSuffix(trimmed, "}") {
+		return trimmed, nil
+	}
+
+	// Try each " {" candidate from the left; the first that decodes wins.
+	// Messages may themselves contain braces, so a few attempts are needed.
+	offset := 0
+	for attempts := 0; attempts < 8; attempts++ {
+		idx := strings.Index(trimmed[offset:], "{")
+		if idx == -1 {
+			break
+		}
+		start := offset + idx
+		if start > 0 && trimmed[start-1] != ' ' {
+			offset = start + 1
+			continue
+		}
+
+		var context map[string]interface{}
+		if err := json.Unmarshal([]byte(escapeRawNewlines(trimmed[start:])), &context); err == nil {
+			return strings.TrimSpace(trimmed[:start]), context
+		}
+		offset = start + 1
+	}
+
+	return trimmed, nil
+}
+
+// stripEmptyArrays removes the "[]" placeholders Monolog prints for an
+// empty context and/or extra ("message [] []")
+func stripEmptyArrays(body string) string {
+	trimmed := strings.TrimRight(body, " \r\n")
+	for i := 0; i < 2 && strings.HasSuffix(trimmed, " []"); i++ {
+		trimmed = strings.TrimRight(trimmed[:len(trimmed)-3], " ")
+	}
+	return trimmed
+}
+
+// escapeRawNewlines makes Monolog's multi-line context strings valid JSON
+func escapeRawNewlines(s string) string {
+	if !strings.ContainsAny(s, "\n\r") {
+		return s
+	}
+	s = strings.ReplaceAll(s, "\r", "")
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+func splitTrace(trace string) []string {
+	var frames []string
+	for _, line := range strings.Split(trace, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line == `"}` || line == `"} []` {
+			continue
+		}
+		frames = append(frames, line)
+	}
+	return frames
+}
+
+// Time parses the entry's timestamp. Monolog only writes an offset with ISO
+// timestamps; Laravel's default format is in app.timezone, given as loc.
+func (e LogEntry) Time(loc *time.Location) (time.Time, bool) {
+	header, _, _ := strings.Cut(e.Raw, "\n")
+	m := logHeaderRe.FindStringSubmatch(header)
+	if m == nil {
+		return time.Time{}, false
+	}
+	ts := strings.Replace(m[1], "T", " ", 1)
+
+	// Fractional seconds are accepted without being in the layout
+	for _, layout := range []string{"2006-01-02 15:04:05Z07:00", "2006-01-02 15:04:05Z0700"} {
+		if t, err := time.Parse(layout, ts); err == nil {
+			return t, true
+		}
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", ts, loc)
+	return t, err == nil
+}
+
+// normalizeTimestamp reduces ISO timestamps to the "Y-m-d H:i:s" form used elsewhere
+func normalizeTimestamp(ts string) string {
+	if len(ts) < 19 {
+		return ts
+	}
+	return strings.Replace(ts[:19], "T", " ", 1)
+}
@@ -0,0 +1,110 @@
+package laravel
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/tail"
+)
+
+const streamPollInterval = 500 * time.Millisecond
+
+// LogFilter narrows streamed entries server-side
+type LogFilter struct {
+	Levels  []string // e.g. ERROR, CRITICAL. Empty matches all.
+	Keyword string   // Case-insensitive substring of the raw entry
+}
+
+func (f LogFilter) Match(entry LogEntry) bool {
+	if len(f.Levels) > 0 {
+		matched := false
+		for _, level := range f.Levels {
+			if strings.EqualFold(level, entry.Level) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if f.Keyword != "" && !strings.Contains(strings.ToLower(entry.Raw), strings.ToLower(f.Keyword)) {
+		return false
+	}
+	return true
+}
+
+// CurrentLogFile returns whichever of laravel.log and the laravel-YYYY-MM-DD.log
+// files of the daily channel was written last, laravel.log if none exists.
+func CurrentLogFile(projectPath string) string {
+	logDir := filepath.Join(projectPath, "storage", "logs")
+	if file := newestFile(channelFiles(filepath.Join(logDir, "laravel"))); file != "" {
+		return file
+	}
+	return filepath.Join(logDir, "laravel.log")
+}
+
+// StreamEntries follows the channel's current log file and sends each new entry
+// matching filter to out until ctx is cancelled.
+func StreamEntries(ctx context.Context, projectPath, channel string, filter LogFilter, out chan<- LogEntry) {
+	var pending []string
+
+	// A channel outside storage/logs is found through artisan once, then
+	// followed by the stem of its files
+	var outside string
+	logDir := filepath.Join(projectPath, "storage", "logs")
+
+	// Re-resolved on every poll so a new daily file is picked up
+	resolve := func() string {
+		if outside != "" {
+			if file := newestFile(channelFiles(outside)); file != "" {
+				return file
+			}
+		}
+		files, err := ResolveLogFiles(projectPath, channel)
+		if err != nil || len(files) == 0 {
+			return CurrentLogFile(projectPath)
+		}
+		if channel != AllChannels && filepath.Dir(files[0]) != logDir {
+			outside = filepath.Join(filepath.Dir(files[0]), channelName(files[0]))
+		}
+		return files[0]
+	}
+
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		name := channelName(resolve())
+		for _, entry := range ParseLogLines(pending) {
+			entry.Channel = name
+			if !filter.Match(entry) {
+				continue
+			}
+			select {
+			case out <- entry:
+			case <-ctx.Done():
+				return
+			}
+		}
+		pending = nil
+	}
+
+	tail.Follow(ctx, resolve, streamPollInterval, func(lines []string) {
+		// An idle poll means the last entry (and its stack trace) is complete
+		if len(lines) == 0 {
+			flush()
+			return
+		}
+
+		for _, line := range lines {
+			// A new header completes the previous entry
+			if IsLogHeader(line) && len(pending) > 0 {
+				flush()
+			}
+			pending = append(pending, line)
+		}
+	})
+}
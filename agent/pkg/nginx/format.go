@@ -0,0 +1,167 @@
+package nginx
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CombinedFormat is nginx's predefined "combined" log_format
+const CombinedFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+
+var variableRe = regexp.MustCompile(`\$\{?([a-z0-9_]+)\}?`)
+
+// Entry is one parsed access log line. Durations are -1 when the format doesn't log them.
+type Entry struct {
+	Time                   time.Time `json:"time"`
+	RemoteAddr             string    `json:"remote_addr,omitempty"`
+	Method                 string    `json:"method"`
+	URI                    string    `json:"uri"`
+	Status                 int       `json:"status"`
+	BytesSent              int64     `json:"bytes_sent"`
+	Referer                string    `json:"referer,omitempty"`
+	UserAgent              string    `json:"user_agent,omitempty"`
+	RequestTimeMS          float64   `json:"request_time_ms"`
+	UpstreamResponseTimeMS float64   `json:"upstream_response_time_ms"`
+	Raw                    string    `json:"raw"`
+	Running                bool      `json:"running,omitempty"` // Not logged yet, see Running
+}
+
+// Started is when nginx began handling the request (logged at completion)
+func (e Entry) Started() time.Time {
+	if e.RequestTimeMS <= 0 {
+		return e.Time
+	}
+	return e.Time.Add(-time.Duration(e.RequestTimeMS * float64(time.Millisecond)))
+}
+
+// Format parses lines written with one log_format
+type Format struct {
+	re     *regexp.Regexp
+	fields []string // Variable name per capture group
+}
+
+// ParseFormat compiles a log_format string ("" or "combined" for the default).
+// Each variable matches up to the literal text that follows it.
+func ParseFormat(format string) (*Format, error) {
+	if format == "" || format == "combined" {
+		format = CombinedFormat
+	}
+
+	var pattern strings.Builder
+	var fields []string
+	pattern.WriteString("^")
+
+	locs := variableRe.FindAllStringSubmatchIndex(format, -1)
+	if len(locs) == 0 {
+		return nil, fmt.Errorf("log format has no variables")
+	}
+
+	last := 0
+	for i, loc := range locs {
+		pattern.WriteString(regexp.QuoteMeta(format[last:loc[0]]))
+		fields = append(fields, format[loc[2]:loc[3]])
+
+		// Stop at the first character of the following literal, or take the rest of the line
+		next := len(format)
+		if i+1 < len(locs) {
+			next = locs[i+1][0]
+		}
+		if loc[1] < next {
+			pattern.WriteString("([^" + regexp.QuoteMeta(format[loc[1]:loc[1]+1]) + "]*)")
+		} else if loc[1] == len(format) {
+			pattern.WriteString("(.*)")
+		} else {
+			return nil, fmt.Errorf("variables $%s and the next one need a separator", fields[len(fields)-1])
+		}
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(format[last:]))
+
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile log format: %v", err)
+	}
+	return &Format{re: re, fields: fields}, nil
+}
+
+// Parse reads one line; false when it doesn't match the format or has no time
+func (f *Format) Parse(line string) (Entry, bool) {
+	m := f.re.FindStringSubmatch(line)
+	if m == nil {
+		return Entry{}, false
+	}
+
+	e := Entry{RequestTimeMS: -1, UpstreamResponseTimeMS: -1, Raw: line}
+	for i, name := range f.fields {
+		v := m[i+1]
+		switch name {
+		case "time_local":
+			e.Time, _ = time.Parse("02/Jan/2006:15:04:05 -0700", v)
+		case "time_iso8601":
+			e.Time, _ = time.Parse(time.RFC3339, v)
+		case "msec":
+			if secs, err := strconv.ParseFloat(v, 64); err == nil {
+				e.Time = time.UnixMilli(int64(secs * 1000))
+			}
+		case "remote_addr":
+			e.RemoteAddr = v
+		case "request":
+			// "GET /path HTTP/1.1"
+			parts := strings.SplitN(v, " ", 3)
+			if len(parts) >= 2 {
+				e.Method, e.URI = parts[0], parts[1]
+			} else {
+				e.URI = v
+			}
+		case "request_method":
+			e.Method = v
+		case "request_uri":
+			e.URI = v
+		case "status":
+			e.Status, _ = strconv.Atoi(v)
+		case "body_bytes_sent", "bytes_sent":
+			e.BytesSent, _ = strconv.ParseInt(v, 10, 64)
+		case "http_referer":
+			e.Referer = dash(v)
+		case "http_user_agent":
+			e.UserAgent = dash(v)
+		case "request_time":
+			e.RequestTimeMS = seconds(v)
+		case "upstream_response_time":
+			e.UpstreamResponseTimeMS = seconds(v)
+		}
+	}
+
+	if e.Time.IsZero() {
+		return Entry{}, false
+	}
+	return e, true
+}
+
+func dash(v string) string {
+	if v == "-" {
+		return ""
+	}
+	return v
+}
+
+// seconds converts an nginx time ("0.123") to milliseconds, summing the
+// "0.010, 0.200" lists upstream times have when several upstreams were tried.
+// -1 for "-" (no upstream).
+func seconds(v string) float64 {
+	total := -1.0
+	for _, part := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ':' || r == ' ' }) {
+		secs, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			continue
+		}
+		if total < 0 {
+			total = 0
+		}
+		total += secs * 1000
+	}
+	return total
+}
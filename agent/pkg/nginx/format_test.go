@@ -0,0 +1,165 @@
+package nginx
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// Custom format logging both timings, with the upstream list quoted
+const timedFormat = `$remote_addr [$time_iso8601] "$request" $status $body_bytes_sent rt=$request_time urt="$upstream_response_time"`
+
+func mustFormat(t *testing.T, format string) *Format {
+	t.Helper()
+	f, err := ParseFormat(format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestParseFormatErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+	}{
+		{"no variables", `plain text`},
+		{"adjacent variables", `$remote_addr$status`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseFormat(tt.format); err == nil {
+				t.Errorf("ParseFormat(%q) succeeded, want an error", tt.format)
+			}
+		})
+	}
+}
+
+func TestParseCombined(t *testing.T) {
+	for _, format := range []string{"", "combined", CombinedFormat} {
+		f := mustFormat(t, format)
+
+		line := `203.0.113.7 - alice [16/Oct/2026:14:03:21 +0200] "POST /checkout?step=2 HTTP/1.1" 502 157 "https://shop.test/cart" "Mozilla/5.0 (X11; Linux x86_64)"`
+		e, ok := f.Parse(line)
+		if !ok {
+			t.Fatalf("format %q: line didn't parse", format)
+		}
+
+		want := time.Date(2026, 10, 16, 12, 3, 21, 0, time.UTC)
+		if !e.Time.Equal(want) {
+			t.Errorf("got time %v, want %v", e.Time, want)
+		}
+		if e.RemoteAddr != "203.0.113.7" || e.Method != "POST" || e.URI != "/checkout?step=2" {
+			t.Errorf("got request %s %s from %s", e.Method, e.URI, e.RemoteAddr)
+		}
+		if e.Status != 502 || e.BytesSent != 157 {
+			t.Errorf("got status %d, bytes %d", e.Status, e.BytesSent)
+		}
+		if e.Referer != "https://shop.test/cart" || e.UserAgent != "Mozilla/5.0 (X11; Linux x86_64)" {
+			t.Errorf("got referer %q, user agent %q", e.Referer, e.UserAgent)
+		}
+		// combined doesn't log timings
+		if e.RequestTimeMS != -1 || e.UpstreamResponseTimeMS != -1 {
+			t.Errorf("got timings %v/%v, want -1", e.RequestTimeMS, e.UpstreamResponseTimeMS)
+		}
+		if e.Raw != line {
+			t.Errorf("got raw %q", e.Raw)
+		}
+	}
+}
+
+func TestParseLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		line     string
+		ok       bool
+		method   string
+		uri      string
+		referer  string
+		request  float64
+		upstream float64
+	}{
+		{
+			name:   "combined without referer",
+			format: CombinedFormat,
+			line:   `127.0.0.1 - - [16/Oct/2026:14:03:21 +0000] "GET / HTTP/1.1" 200 612 "-" "-"`,
+			ok:     true, method: "GET", uri: "/", request: -1, upstream: -1,
+		},
+		{
+			name:   "combined malformed request",
+			format: CombinedFormat,
+			line:   `127.0.0.1 - - [16/Oct/2026:14:03:21 +0000] "-" 400 0 "-" "-"`,
+			ok:     true, uri: "-", request: -1, upstream: -1,
+		},
+		{
+			name:   "combined garbage",
+			format: CombinedFormat,
+			line:   `not an access log line`,
+		},
+		{
+			name:   "combined bad time",
+			format: CombinedFormat,
+			line:   `127.0.0.1 - - [yesterday] "GET / HTTP/1.1" 200 612 "-" "-"`,
+		},
+		{
+			name:   "timed",
+			format: timedFormat,
+			line:   `10.0.0.2 [2026-10-16T14:03:21+00:00] "GET /api/orders HTTP/2.0" 200 5120 rt=1.532 urt="1.530"`,
+			ok:     true, method: "GET", uri: "/api/orders", request: 1532, upstream: 1530,
+		},
+		{
+			name:   "timed with several upstreams",
+			format: timedFormat,
+			line:   `10.0.0.2 [2026-10-16T14:03:21+00:00] "GET /api/orders HTTP/2.0" 504 0 rt=60.001 urt="30.000, 30.001"`,
+			ok:     true, method: "GET", uri: "/api/orders", request: 60001, upstream: 60001,
+		},
+		{
+			name:   "timed without upstream",
+			format: timedFormat,
+			line:   `10.0.0.2 [2026-10-16T14:03:21+00:00] "GET /favicon.ico HTTP/2.0" 404 0 rt=0.000 urt="-"`,
+			ok:     true, method: "GET", uri: "/favicon.ico", request: 0, upstream: -1,
+		},
+		{
+			name:   "msec time and split request",
+			format: `$msec $request_method $request_uri $request_time`,
+			line:   `1792159401.250 PUT /jobs/7 0.250`,
+			ok:     true, method: "PUT", uri: "/jobs/7", request: 250, upstream: -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, ok := mustFormat(t, tt.format).Parse(tt.line)
+			if ok != tt.ok {
+				t.Fatalf("got ok %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if e.Time.IsZero() {
+				t.Error("got zero time")
+			}
+			if e.Method != tt.method || e.URI != tt.uri || e.Referer != tt.referer {
+				t.Errorf("got %q %q referer %q, want %q %q referer %q", e.Method, e.URI, e.Referer, tt.method, tt.uri, tt.referer)
+			}
+			if !approx(e.RequestTimeMS, tt.request) || !approx(e.UpstreamResponseTimeMS, tt.upstream) {
+				t.Errorf("got timings %v/%v, want %v/%v", e.RequestTimeMS, e.UpstreamResponseTimeMS, tt.request, tt.upstream)
+			}
+		})
+	}
+}
+
+func TestEntryStarted(t *testing.T) {
+	end := time.Date(2026, 10, 16, 14, 3, 21, 0, time.UTC)
+	if got := (Entry{Time: end, RequestTimeMS: 1500}).Started(); !got.Equal(end.Add(-1500 * time.Millisecond)) {
+		t.Errorf("got %v", got)
+	}
+	// Without request_time the start is unknown, so it's taken as the end
+	if got := (Entry{Time: end, RequestTimeMS: -1}).Started(); !got.Equal(end) {
+		t.Errorf("got %v, want %v", got, end)
+	}
+}
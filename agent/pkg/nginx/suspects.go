@@ -0,0 +1,137 @@
+package nginx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/tail"
+)
+
+const (
+	maxSuspects = 10
+
+	// Lines are written when requests finish, out of start order; keep scanning
+	// this far past the window start so long requests that began in it are found
+	maxRequestSlack = 5 * time.Minute
+)
+
+// Suspects are the requests most likely behind an incident
+type Suspects struct {
+	From     time.Time    `json:"from"`
+	To       time.Time    `json:"to"`
+	Total    int          `json:"total"`    // Requests in flight during the window, running ones included
+	Slowest  []Entry      `json:"slowest"`  // By request_time (time so far when running), or newest first when it isn't logged
+	Frequent []RouteCount `json:"frequent"` // Most requested paths
+}
+
+// RouteCount aggregates the requests of one method + path (query string dropped)
+type RouteCount struct {
+	Method  string  `json:"method"`
+	Path    string  `json:"path"`
+	Count   int     `json:"count"`
+	TotalMS float64 `json:"total_ms"` // Sum of request_time, 0 when it isn't logged
+	MaxMS   float64 `json:"max_ms"`
+}
+
+// Running is a request still being served at the end of the window, e.g. a busy
+// worker on the FPM status page. nginx only logs requests once they finish, so
+// these are missing from the access log.
+type Running struct {
+	PID        int
+	Method     string
+	URI        string
+	DurationMS float64 // So far
+}
+
+// entry places the request in the log's terms, as if it finished at to
+func (r Running) entry(to time.Time) Entry {
+	return Entry{
+		Time:          to,
+		Method:        r.Method,
+		URI:           r.URI,
+		RequestTimeMS: r.DurationMS,
+		Running:       true,
+		Raw:           fmt.Sprintf("[running, pid %d] %s %s %.0fms so far", r.PID, r.Method, r.URI, r.DurationMS),
+	}
+}
+
+// FindSuspects reads the access log at path for the requests in flight between
+// from and to, and adds the ones still running. An empty path only lists running.
+func FindSuspects(path string, format *Format, running []Running, from, to time.Time) (*Suspects, error) {
+	var entries []Entry
+	for _, r := range running {
+		entries = append(entries, r.entry(to))
+	}
+	if path == "" || format == nil {
+		return summarize(entries, from, to), nil
+	}
+
+	err := tail.Backward(path, func(line string) bool {
+		e, ok := format.Parse(line)
+		if !ok {
+			return true
+		}
+		if e.Time.Before(from.Add(-maxRequestSlack)) {
+			return false // Everything older finished too early to matter
+		}
+		// In flight during the window: started before it ended, finished after it began
+		if !e.Started().After(to) && !e.Time.Before(from) {
+			entries = append(entries, e)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summarize(entries, from, to), nil
+}
+
+func summarize(entries []Entry, from, to time.Time) *Suspects {
+	s := &Suspects{From: from, To: to, Total: len(entries), Slowest: []Entry{}, Frequent: []RouteCount{}}
+
+	// 1. Slowest (entries arrive newest first, which the stable sort keeps for ties)
+	slowest := append([]Entry(nil), entries...)
+	sort.SliceStable(slowest, func(i, j int) bool { return slowest[i].RequestTimeMS > slowest[j].RequestTimeMS })
+	if len(slowest) > maxSuspects {
+		slowest = slowest[:maxSuspects]
+	}
+	s.Slowest = append(s.Slowest, slowest...)
+
+	// 2. Most frequent
+	counts := make(map[string]*RouteCount)
+	for _, e := range entries {
+		path, _, _ := strings.Cut(e.URI, "?")
+		key := e.Method + " " + path
+		c, ok := counts[key]
+		if !ok {
+			c = &RouteCount{Method: e.Method, Path: path}
+			counts[key] = c
+		}
+		c.Count++
+		if e.RequestTimeMS > 0 {
+			c.TotalMS += e.RequestTimeMS
+			if e.RequestTimeMS > c.MaxMS {
+				c.MaxMS = e.RequestTimeMS
+			}
+		}
+	}
+	for _, c := range counts {
+		s.Frequent = append(s.Frequent, *c)
+	}
+	sort.Slice(s.Frequent, func(i, j int) bool {
+		a, b := s.Frequent[i], s.Frequent[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.TotalMS != b.TotalMS {
+			return a.TotalMS > b.TotalMS
+		}
+		return a.Method+a.Path < b.Method+b.Path
+	})
+	if len(s.Frequent) > maxSuspects {
+		s.Frequent = s.Frequent[:maxSuspects]
+	}
+	return s
+}
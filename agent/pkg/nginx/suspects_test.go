@@ -0,0 +1,62 @@
+package nginx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindSuspects(t *testing.T) {
+	f := mustFormat(t, timedFormat)
+	lines := []string{
+		`10.0.0.2 [2026-10-16T13:50:00+00:00] "GET /old HTTP/1.1" 200 10 rt=0.100 urt="-"`,     // Finished long before
+		`10.0.0.2 [2026-10-16T14:00:30+00:00] "GET /report HTTP/1.1" 200 10 rt=90.000 urt="-"`, // Started before, ran into the window
+		`10.0.0.2 [2026-10-16T14:01:00+00:00] "GET /a?x=1 HTTP/1.1" 200 10 rt=0.200 urt="-"`,
+		`10.0.0.2 [2026-10-16T14:01:30+00:00] "GET /a?x=2 HTTP/1.1" 200 10 rt=0.400 urt="-"`,
+		`not a log line`,
+		`10.0.0.2 [2026-10-16T14:10:00+00:00] "GET /later HTTP/1.1" 200 10 rt=1.000 urt="-"`, // Started after
+	}
+	path := filepath.Join(t.TempDir(), "access.log")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	from := time.Date(2026, 10, 16, 14, 0, 0, 0, time.UTC)
+	to := from.Add(2 * time.Minute)
+	running := []Running{{PID: 42, Method: "POST", URI: "/import", DurationMS: 45000}}
+
+	s, err := FindSuspects(path, f, running, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Total != 4 {
+		t.Errorf("got %d requests, want 4", s.Total)
+	}
+
+	var slowest []string
+	for _, e := range s.Slowest {
+		slowest = append(slowest, e.URI)
+	}
+	if got, want := strings.Join(slowest, " "), "/report /import /a?x=2 /a?x=1"; got != want {
+		t.Errorf("got slowest %s, want %s", got, want)
+	}
+	if !s.Slowest[1].Running || !s.Slowest[1].Time.Equal(to) {
+		t.Errorf("running request got %+v", s.Slowest[1])
+	}
+
+	top := s.Frequent[0]
+	if top.Path != "/a" || top.Count != 2 || !approx(top.TotalMS, 600) || !approx(top.MaxMS, 400) {
+		t.Errorf("got top route %+v", top)
+	}
+
+	// Without an access log, only the running requests are listed
+	s, err = FindSuspects("", nil, running, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Total != 1 || s.Slowest[0].URI != "/import" {
+		t.Errorf("got %+v", s)
+	}
+}
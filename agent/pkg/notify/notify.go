@@ -0,0 +1,273 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/config"
+	"github.com/mike/sentinel-agent/pkg/watchdog"
+)
+
+const (
+	queueSize         = 100 // Events buffered per sink while it is retrying
+	defaultMaxRetries = 3
+	initialBackoff    = 1 * time.Second
+	maxBackoff        = 30 * time.Second
+	testTimeout       = 5 * time.Second // Whole test-fire, every sink included
+)
+
+// Event types
+const (
+	EventOpened   = "incident.opened"
+	EventResolved = "incident.resolved"
+	EventTest     = "test"
+)
+
+// Event is what every sink receives
+type Event struct {
+	Event    string            `json:"event"`
+	Incident watchdog.Incident `json:"incident"`
+	Host     string            `json:"host"`
+	SentAt   time.Time         `json:"sent_at"`
+}
+
+// sink delivers one event; errors from retryable failures are wrapped in retryable
+type sink interface {
+	send(ctx context.Context, event Event) error
+}
+
+// retryable marks a delivery error worth another attempt
+type retryable struct{ err error }
+
+func (r retryable) Error() string { return r.err.Error() }
+
+// Stats counts deliveries of one sink, for /alerts/sinks
+type Stats struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Sent      uint64 `json:"sent"`
+	Failed    uint64 `json:"failed"`  // Given up on after retries
+	Dropped   uint64 `json:"dropped"` // Queue full
+	LastError string `json:"last_error,omitempty"`
+}
+
+// TestResult is the outcome of a test-fire to one sink
+type TestResult struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// worker owns one sink: its queue, retries and counters
+type worker struct {
+	cfg   config.SinkConfig
+	sink  sink
+	queue chan Event
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// Dispatcher fans incidents out to the configured sinks. Each sink has its own
+// queue, so a slow or failing sink never holds up the others or the watchdog.
+type Dispatcher struct {
+	workers []*worker
+	host    string
+}
+
+func New(sinks []config.SinkConfig) *Dispatcher {
+	host, _ := os.Hostname()
+	d := &Dispatcher{host: host}
+
+	for _, cfg := range sinks {
+		if cfg.Disabled {
+			continue
+		}
+		s, err := newSink(cfg)
+		if err != nil {
+			fmt.Printf("[Notify] Skipping sink %q: %v\n", cfg.Name, err)
+			continue
+		}
+		d.workers = append(d.workers, &worker{
+			cfg:   cfg,
+			sink:  s,
+			queue: make(chan Event, queueSize),
+			stats: Stats{Name: cfg.Name, Type: cfg.Type},
+		})
+	}
+	return d
+}
+
+// Validate rejects sink settings that can't work
+func Validate(cfg config.SinkConfig) error {
+	if cfg.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if cfg.MaxRetries < 0 {
+		return fmt.Errorf("max_retries must not be negative")
+	}
+	switch cfg.MinSeverity {
+	case "", "info", "warning", "critical":
+	default:
+		return fmt.Errorf("invalid min_severity %q", cfg.MinSeverity)
+	}
+	_, err := newSink(cfg)
+	return err
+}
+
+// Notify queues an opened or resolved incident for every sink that wants it
+func (d *Dispatcher) Notify(incident watchdog.Incident) {
+	event := Event{Event: EventOpened, Incident: incident, Host: d.host}
+	if incident.State == watchdog.StateResolved {
+		event.Event = EventResolved
+	}
+
+	for _, w := range d.workers {
+		if severityRank(incident.Severity) < severityRank(w.cfg.MinSeverity) {
+			continue
+		}
+		select {
+		case w.queue <- event:
+		default:
+			w.mu.Lock()
+			w.stats.Dropped++
+			w.mu.Unlock()
+		}
+	}
+}
+
+// Run delivers queued events until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	for _, w := range d.workers {
+		go w.run(ctx)
+	}
+	<-ctx.Done()
+}
+
+// Test sends a sample incident to the named sink (every sink when name is "")
+// and reports each outcome. It's a single attempt per sink, all sinks at once,
+// so a dead endpoint answers within testTimeout instead of after the retries.
+func (d *Dispatcher) Test(ctx context.Context, name string) []TestResult {
+	ctx, cancel := context.WithTimeout(ctx, testTimeout)
+	defer cancel()
+
+	now := time.Now()
+	event := Event{
+		Event:  EventTest,
+		Host:   d.host,
+		SentAt: now,
+		Incident: watchdog.Incident{
+			ID:         "test",
+			State:      watchdog.StateOpen,
+			Timestamp:  now,
+			Rule:       "test",
+			Metric:     watchdog.MetricFpmCPU,
+			Severity:   "info",
+			Comparison: ">=",
+			Message:    "Test notification from Sentinel",
+		},
+	}
+
+	var workers []*worker
+	for _, w := range d.workers {
+		if name == "" || w.cfg.Name == name {
+			workers = append(workers, w)
+		}
+	}
+
+	results := make([]TestResult, len(workers))
+	var wg sync.WaitGroup
+	for i, w := range workers {
+		results[i] = TestResult{Name: w.cfg.Name, OK: true}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.sink.send(ctx, event); err != nil {
+				results[i].OK = false
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (d *Dispatcher) Stats() []Stats {
+	stats := make([]Stats, 0, len(d.workers))
+	for _, w := range d.workers {
+		w.mu.Lock()
+		stats = append(stats, w.stats)
+		w.mu.Unlock()
+	}
+	return stats
+}
+
+func (w *worker) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-w.queue:
+			w.deliver(ctx, event)
+		}
+	}
+}
+
+// deliver sends one event, retrying with exponential backoff on retryable errors
+func (w *worker) deliver(ctx context.Context, event Event) error {
+	retries := w.cfg.MaxRetries
+	if retries == 0 {
+		retries = defaultMaxRetries
+	}
+	backoff := initialBackoff
+
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+
+		event.SentAt = time.Now()
+		err = w.sink.send(ctx, event)
+		if err == nil {
+			break
+		}
+		if _, ok := err.(retryable); !ok {
+			break
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err != nil {
+		w.stats.Failed++
+		w.stats.LastError = err.Error()
+		fmt.Printf("[Notify] %s: failed to deliver %s: %v\n", w.cfg.Name, event.Event, err)
+		return err
+	}
+	w.stats.Sent++
+	return nil
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case "critical":
+		return 2
+	case "warning":
+		return 1
+	}
+	return 0 // info, or no minimum
+}
@@ -0,0 +1,259 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/config"
+	"github.com/mike/sentinel-agent/pkg/watchdog"
+)
+
+// request is what the test server saw of one delivery
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver answers with the given status codes in turn (the last one repeats)
+// and hands every request it gets to the test
+func receiver(t *testing.T, statuses ...int) (*httptest.Server, <-chan request, *atomic.Int32) {
+	t.Helper()
+
+	requests := make(chan request, 16)
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		n := int(hits.Add(1))
+		requests <- request{header: r.Header.Clone(), body: body}
+		w.WriteHeader(statuses[min(n, len(statuses))-1])
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests, &hits
+}
+
+func newWorker(t *testing.T, cfg config.SinkConfig) *worker {
+	t.Helper()
+
+	d := New([]config.SinkConfig{cfg})
+	if len(d.workers) != 1 {
+		t.Fatalf("sink %+v was not created", cfg)
+	}
+	return d.workers[0]
+}
+
+func event() Event {
+	return Event{
+		Event: EventOpened,
+		Host:  "web-1",
+		Incident: watchdog.Incident{
+			ID:        "abc",
+			State:     watchdog.StateOpen,
+			Rule:      "High CPU",
+			Severity:  "critical",
+			PeakValue: 97.5,
+			Message:   "CPU at 97.5%",
+		},
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	srv, requests, _ := receiver(t, http.StatusOK)
+	w := newWorker(t, config.SinkConfig{Name: "hook", Type: config.SinkWebhook, URL: srv.URL, Secret: "s3cret"})
+
+	if err := w.deliver(context.Background(), event()); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+
+	if got := req.header.Get("X-Sentinel-Event"); got != EventOpened {
+		t.Fatalf("X-Sentinel-Event is %q", got)
+	}
+	ts := req.header.Get("X-Sentinel-Timestamp")
+	if sec, err := strconv.ParseInt(ts, 10, 64); err != nil || time.Since(time.Unix(sec, 0)) > time.Minute {
+		t.Fatalf("X-Sentinel-Timestamp %q is not the send time", ts)
+	}
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(ts + "."))
+	mac.Write(req.body)
+	if got, want := req.header.Get("X-Sentinel-Signature"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Fatalf("X-Sentinel-Signature is %q, want %q", got, want)
+	}
+
+	var got Event
+	if err := json.Unmarshal(req.body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Incident.ID != "abc" || got.Host != "web-1" {
+		t.Fatalf("body is %s", req.body)
+	}
+}
+
+func TestWebhookWithoutSecret(t *testing.T) {
+	srv, requests, _ := receiver(t, http.StatusOK)
+	w := newWorker(t, config.SinkConfig{Name: "hook", Type: config.SinkWebhook, URL: srv.URL})
+
+	if err := w.deliver(context.Background(), event()); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	if req.header.Get("X-Sentinel-Signature") != "" || req.header.Get("X-Sentinel-Timestamp") != "" {
+		t.Fatalf("unsigned webhook sent signature headers: %v", req.header)
+	}
+}
+
+func TestSlackPayload(t *testing.T) {
+	srv, requests, _ := receiver(t, http.StatusOK)
+	w := newWorker(t, config.SinkConfig{Name: "slack", Type: config.SinkSlack, URL: srv.URL})
+
+	if err := w.deliver(context.Background(), event()); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+
+	// Decoded loosely, so the test checks the wire format rather than our own types
+	var msg struct {
+		Text        string `json:"text"`
+		Attachments []struct {
+			Color  string `json:"color"`
+			Fields []struct {
+				Title string `json:"title"`
+				Value string `json:"value"`
+				Short bool   `json:"short"`
+			} `json:"fields"`
+		} `json:"attachments"`
+	}
+	if err := json.Unmarshal(req.body, &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "*[CRITICAL] High CPU* CPU at 97.5%"; msg.Text != want {
+		t.Fatalf("text is %q, want %q", msg.Text, want)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Color != "danger" {
+		t.Fatalf("attachments are %+v", msg.Attachments)
+	}
+	fields := map[string]string{}
+	for _, f := range msg.Attachments[0].Fields {
+		fields[f.Title] = f.Value
+	}
+	want := map[string]string{"Rule": "High CPU", "Severity": "critical", "Peak": "97.50", "Host": "web-1"}
+	for title, value := range want {
+		if fields[title] != value {
+			t.Fatalf("field %s is %q, want %q", title, fields[title], value)
+		}
+	}
+}
+
+func TestRetryOnServerError(t *testing.T) {
+	srv, _, hits := receiver(t, http.StatusServiceUnavailable, http.StatusOK)
+	w := newWorker(t, config.SinkConfig{Name: "hook", Type: config.SinkWebhook, URL: srv.URL, MaxRetries: 1})
+
+	if err := w.deliver(context.Background(), event()); err != nil {
+		t.Fatalf("delivery failed after a retry: %v", err)
+	}
+	if n := hits.Load(); n != 2 {
+		t.Fatalf("got %d attempts, want 2", n)
+	}
+	if stats := w.stats; stats.Sent != 1 || stats.Failed != 0 {
+		t.Fatalf("stats are %+v", stats)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	srv, _, hits := receiver(t, http.StatusBadGateway)
+	w := newWorker(t, config.SinkConfig{Name: "hook", Type: config.SinkWebhook, URL: srv.URL, MaxRetries: 1})
+
+	if err := w.deliver(context.Background(), event()); err == nil {
+		t.Fatal("delivery to a failing endpoint succeeded")
+	}
+	if n := hits.Load(); n != 2 {
+		t.Fatalf("got %d attempts, want 2", n)
+	}
+	if stats := w.stats; stats.Failed != 1 || stats.LastError == "" {
+		t.Fatalf("stats are %+v", stats)
+	}
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound} {
+		srv, _, hits := receiver(t, status, http.StatusOK)
+		w := newWorker(t, config.SinkConfig{Name: "hook", Type: config.SinkWebhook, URL: srv.URL, MaxRetries: 3})
+
+		start := time.Now()
+		if err := w.deliver(context.Background(), event()); err == nil {
+			t.Fatalf("status %d: delivery succeeded", status)
+		}
+		if n := hits.Load(); n != 1 {
+			t.Fatalf("status %d: got %d attempts, want 1", status, n)
+		}
+		if time.Since(start) >= initialBackoff {
+			t.Fatalf("status %d: waited for a retry", status)
+		}
+	}
+}
+
+func TestDispatcherTestSingleAttempt(t *testing.T) {
+	failing, _, failingHits := receiver(t, http.StatusServiceUnavailable)
+	working, requests, _ := receiver(t, http.StatusOK)
+	d := New([]config.SinkConfig{
+		{Name: "failing", Type: config.SinkWebhook, URL: failing.URL, MaxRetries: 3},
+		{Name: "working", Type: config.SinkSlack, URL: working.URL},
+	})
+
+	start := time.Now()
+	results := d.Test(context.Background(), "")
+	if time.Since(start) >= initialBackoff {
+		t.Fatal("test-fire waited for retries")
+	}
+	if n := failingHits.Load(); n != 1 {
+		t.Fatalf("failing sink got %d attempts, want 1", n)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if r := results[0]; r.Name != "failing" || r.OK || r.Error == "" {
+		t.Fatalf("failing sink result is %+v", r)
+	}
+	if r := results[1]; r.Name != "working" || !r.OK {
+		t.Fatalf("working sink result is %+v", r)
+	}
+	if req := <-requests; len(req.body) == 0 {
+		t.Fatal("working sink got an empty test message")
+	}
+
+	if results := d.Test(context.Background(), "working"); len(results) != 1 || results[0].Name != "working" {
+		t.Fatalf("named test-fire got %+v", results)
+	}
+	if results := d.Test(context.Background(), "missing"); len(results) != 0 {
+		t.Fatalf("unknown sink got %+v", results)
+	}
+}
+
+func TestDispatcherTestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	stuck := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer stuck.Close()
+	defer close(release) // Before Close, which waits for the handler
+	d := New([]config.SinkConfig{{Name: "stuck", Type: config.SinkWebhook, URL: stuck.URL}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	results := d.Test(ctx, "")
+	if len(results) != 1 || results[0].OK {
+		t.Fatalf("stuck sink result is %+v", results)
+	}
+}
@@ -0,0 +1,233 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/config"
+)
+
+const sinkTimeout = 10 * time.Second
+
+func newSink(cfg config.SinkConfig) (sink, error) {
+	client := &http.Client{Timeout: sinkTimeout}
+
+	switch cfg.Type {
+	case config.SinkWebhook:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+		return &webhookSink{url: cfg.URL, secret: cfg.Secret, client: client}, nil
+	case config.SinkSlack:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+		return &slackSink{url: cfg.URL, client: client}, nil
+	case config.SinkDesktop:
+		if runtime.GOOS != "linux" {
+			return nil, fmt.Errorf("desktop notifications need notify-send (Linux)")
+		}
+		return &desktopSink{}, nil
+	case config.SinkCommand:
+		if cfg.Command == "" {
+			return nil, fmt.Errorf("command is required")
+		}
+		return &commandSink{command: cfg.Command, args: cfg.Args}, nil
+	}
+	return nil, fmt.Errorf("unknown sink type %q", cfg.Type)
+}
+
+// webhookSink POSTs the event as JSON. With a secret, X-Sentinel-Signature is
+// "sha256=" + hex HMAC-SHA256 of "<X-Sentinel-Timestamp>.<body>", so receivers
+// can verify the sender and reject replays.
+type webhookSink struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func (s *webhookSink) send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+
+	headers := map[string]string{"X-Sentinel-Event": event.Event}
+	if s.secret != "" {
+		ts := strconv.FormatInt(event.SentAt.Unix(), 10)
+		headers["X-Sentinel-Timestamp"] = ts
+		headers["X-Sentinel-Signature"] = "sha256=" + sign(s.secret, ts, body)
+	}
+	return post(ctx, s.client, s.url, body, headers)
+}
+
+func sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// slackSink posts to a Slack or Mattermost incoming webhook
+type slackSink struct {
+	url    string
+	client *http.Client
+}
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Fields []slackField `json:"fields"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func (s *slackSink) send(ctx context.Context, event Event) error {
+	inc := event.Incident
+	msg := slackMessage{
+		Text: fmt.Sprintf("*%s* %s", title(event), inc.Message),
+		Attachments: []slackAttachment{{
+			Color: color(event),
+			Fields: []slackField{
+				{Title: "Rule", Value: inc.Rule, Short: true},
+				{Title: "Severity", Value: inc.Severity, Short: true},
+				{Title: "Peak", Value: strconv.FormatFloat(inc.PeakValue, 'f', 2, 64), Short: true},
+				{Title: "Host", Value: event.Host, Short: true},
+			},
+		}},
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %v", err)
+	}
+	return post(ctx, s.client, s.url, body, nil)
+}
+
+// desktopSink shows a notify-send popup
+type desktopSink struct{}
+
+func (s *desktopSink) send(ctx context.Context, event Event) error {
+	urgency := "normal"
+	switch {
+	case event.Event == EventResolved:
+		urgency = "low"
+	case event.Incident.Severity == "critical":
+		urgency = "critical"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sinkTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "notify-send", "-u", urgency, "-a", "Sentinel", title(event), event.Incident.Message).CombinedOutput()
+	if err != nil {
+		return retryable{fmt.Errorf("notify-send failed: %v %s", err, strings.TrimSpace(string(out)))}
+	}
+	return nil
+}
+
+// commandSink runs a local command with the event JSON on stdin and the
+// main fields in SENTINEL_* environment variables
+type commandSink struct {
+	command string
+	args    []string
+}
+
+func (s *commandSink) send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sinkTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.command, s.args...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(cmd.Environ(),
+		"SENTINEL_EVENT="+event.Event,
+		"SENTINEL_INCIDENT_ID="+event.Incident.ID,
+		"SENTINEL_RULE="+event.Incident.Rule,
+		"SENTINEL_SEVERITY="+event.Incident.Severity,
+		"SENTINEL_STATE="+event.Incident.State,
+		"SENTINEL_MESSAGE="+event.Incident.Message,
+	)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return retryable{fmt.Errorf("command failed: %v %s", err, strings.TrimSpace(string(out)))}
+	}
+	return nil
+}
+
+// post sends a JSON body; network errors, 429 and 5xx are retryable
+func post(ctx context.Context, client *http.Client, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sentinel-agent")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return retryable{fmt.Errorf("failed to reach %s: %v", url, err)}
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("%s returned %s", url, resp.Status)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return retryable{err}
+	}
+	return err
+}
+
+func title(event Event) string {
+	switch event.Event {
+	case EventResolved:
+		return "Resolved: " + event.Incident.Rule
+	case EventTest:
+		return "Sentinel test notification"
+	}
+	return fmt.Sprintf("[%s] %s", strings.ToUpper(event.Incident.Severity), event.Incident.Rule)
+}
+
+func color(event Event) string {
+	if event.Event == EventResolved {
+		return "good"
+	}
+	switch event.Incident.Severity {
+	case "critical":
+		return "danger"
+	case "info":
+		return "#439FE0"
+	}
+	return "warning"
+}
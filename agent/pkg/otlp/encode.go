@@ -0,0 +1,438 @@
+package otlp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/laravel"
+	"github.com/mike/sentinel-agent/pkg/telemetry"
+)
+
+// OTLP/HTTP JSON encoding of the trace and metrics export requests.
+// See opentelemetry-proto: 64-bit integers are encoded as decimal strings,
+// trace and span ids as hex.
+
+type exportTraceRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            *status    `json:"status,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type exportMetricsRequest struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+type resourceMetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+type scopeMetrics struct {
+	Scope   scope    `json:"scope"`
+	Metrics []metric `json:"metrics"`
+}
+
+type metric struct {
+	Name        string     `json:"name"`
+	Unit        string     `json:"unit"`
+	Description string     `json:"description,omitempty"`
+	Histogram   *histogram `json:"histogram"`
+}
+
+type histogram struct {
+	DataPoints             []histogramPoint `json:"dataPoints"`
+	AggregationTemporality int              `json:"aggregationTemporality"`
+}
+
+type histogramPoint struct {
+	Attributes        []keyValue `json:"attributes"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	Count             string     `json:"count"`
+	Sum               float64    `json:"sum"`
+	BucketCounts      []string   `json:"bucketCounts"`
+	ExplicitBounds    []float64  `json:"explicitBounds"`
+	Min               float64    `json:"min"`
+	Max               float64    `json:"max"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// Span kinds and status codes from the OTLP spec
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+	spanKindConsumer = 5
+
+	statusError = 2
+
+	temporalityDelta = 1
+)
+
+const scopeName = "sentinel-agent"
+
+func str(key, value string) keyValue {
+	return keyValue{Key: key, Value: anyValue{StringValue: &value}}
+}
+
+func integer(key string, value int64) keyValue {
+	v := strconv.FormatInt(value, 10)
+	return keyValue{Key: key, Value: anyValue{IntValue: &v}}
+}
+
+func double(key string, value float64) keyValue {
+	return keyValue{Key: key, Value: anyValue{DoubleValue: &value}}
+}
+
+func boolean(key string, value bool) keyValue {
+	return keyValue{Key: key, Value: anyValue{BoolValue: &value}}
+}
+
+func nanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// resourceFor describes the service an entry belongs to
+func resourceFor(projectPath, serviceName string) resource {
+	if serviceName == "" {
+		serviceName = filepath.Base(projectPath)
+	}
+	return resource{Attributes: []keyValue{
+		str("service.name", serviceName),
+		str("service.namespace", "laravel"),
+		str("laravel.project.path", projectPath),
+		str("telemetry.sdk.name", scopeName),
+	}}
+}
+
+// entryTimes returns when the entry started and ended, from the probe's epoch
+// start time. Older probes only send the shutdown timestamp, which is cut to
+// seconds and in app.timezone, so it's taken as the end in local time.
+func entryTimes(entry laravel.PerformanceEntry) (start, end time.Time) {
+	duration := time.Duration(entry.DurationMS * float64(time.Millisecond))
+	if entry.StartUnixMS > 0 {
+		start = time.Unix(0, int64(entry.StartUnixMS*float64(time.Millisecond)))
+		return start, start.Add(duration)
+	}
+
+	end, err := time.ParseInLocation("2006-01-02 15:04:05", entry.Timestamp, time.Local)
+	if err != nil {
+		end = time.Now()
+	}
+	start = end.Add(-duration)
+	return start, end
+}
+
+// spansFor converts an entry to OTLP spans: its span tree when the probe traced
+// it, otherwise a single span covering the whole request, job or command.
+func spansFor(entry laravel.PerformanceEntry, route string) []span {
+	start, end := entryTimes(entry)
+	traceID := validID(entry.TraceID, 32)
+
+	root := span{
+		TraceID:           traceID,
+		Name:              rootName(entry, route),
+		Kind:              rootKind(entry),
+		StartTimeUnixNano: nanos(start),
+		EndTimeUnixNano:   nanos(end),
+		Attributes:        entryAttributes(entry, route),
+	}
+	if entry.Exception != "" || entry.Failed || entry.Status >= 500 {
+		root.Status = &status{Code: statusError, Message: entry.Exception}
+	}
+
+	if len(entry.Spans) == 0 {
+		root.SpanID = randomID(8)
+		return []span{root}
+	}
+
+	// Span ids from the probe are kept when they are valid OTLP ids
+	ids := make(map[string]string, len(entry.Spans))
+	for _, s := range entry.Spans {
+		ids[s.ID] = validID(s.ID, 16)
+	}
+
+	spans := make([]span, 0, len(entry.Spans))
+	for _, s := range entry.Spans {
+		spanStart := start.Add(time.Duration(s.StartMS * float64(time.Millisecond)))
+		spanEnd := spanStart.Add(time.Duration(s.DurationMS * float64(time.Millisecond)))
+
+		if s.Kind == "request" {
+			// The probe's root span carries the entry details
+			r := root
+			r.SpanID = ids[s.ID]
+			spans = append(spans, r)
+			continue
+		}
+
+		out := span{
+			TraceID:           traceID,
+			SpanID:            ids[s.ID],
+			ParentSpanID:      ids[s.ParentID],
+			Name:              s.Name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: nanos(spanStart),
+			EndTimeUnixNano:   nanos(spanEnd),
+			Attributes:        []keyValue{str("laravel.span.kind", s.Kind)},
+		}
+		switch s.Kind {
+		case "db":
+			out.Kind = spanKindClient
+			out.Attributes = append(out.Attributes, str("db.statement", s.Name))
+			if conn, ok := s.Attributes["connection"].(string); ok {
+				out.Attributes = append(out.Attributes, str("db.name", conn))
+			}
+		case "http":
+			out.Kind = spanKindClient
+			if code, ok := s.Attributes["status"].(float64); ok {
+				out.Attributes = append(out.Attributes, integer("http.response.status_code", int64(code)))
+			}
+		}
+		for key, value := range s.Attributes {
+			switch v := value.(type) {
+			case string:
+				out.Attributes = append(out.Attributes, str("laravel."+key, v))
+			case float64:
+				out.Attributes = append(out.Attributes, double("laravel."+key, v))
+			case bool:
+				out.Attributes = append(out.Attributes, boolean("laravel."+key, v))
+			}
+		}
+		spans = append(spans, out)
+	}
+	return spans
+}
+
+func rootName(entry laravel.PerformanceEntry, route string) string {
+	switch entry.EntryKind() {
+	case laravel.KindJob, laravel.KindCommand:
+		return entry.Name
+	}
+	return entry.Method + " " + route
+}
+
+func rootKind(entry laravel.PerformanceEntry) int {
+	switch entry.EntryKind() {
+	case laravel.KindJob:
+		return spanKindConsumer
+	case laravel.KindCommand:
+		return spanKindInternal
+	}
+	return spanKindServer
+}
+
+// entryAttributes maps entry fields to semantic convention attributes where one exists
+func entryAttributes(entry laravel.PerformanceEntry, route string) []keyValue {
+	attrs := []keyValue{
+		str("laravel.kind", entry.EntryKind()),
+		double("laravel.memory_mb", entry.MemoryMB),
+		integer("laravel.query_count", int64(entry.QueryCount)),
+	}
+
+	switch entry.EntryKind() {
+	case laravel.KindJob:
+		attrs = append(attrs,
+			str("messaging.destination.name", entry.Queue),
+			str("messaging.system", entry.Connection),
+			integer("laravel.job.attempts", int64(entry.Attempts)),
+			boolean("laravel.failed", entry.Failed),
+		)
+	case laravel.KindCommand:
+		attrs = append(attrs,
+			str("process.command", entry.Name),
+			integer("process.exit.code", int64(entry.ExitCode)),
+		)
+	default:
+		attrs = append(attrs,
+			str("http.request.method", entry.Method),
+			str("url.path", entry.URI),
+			str("http.route", route),
+		)
+		if entry.Status > 0 {
+			attrs = append(attrs, integer("http.response.status_code", int64(entry.Status)))
+		}
+		if entry.RouteName != "" {
+			attrs = append(attrs, str("laravel.route.name", entry.RouteName))
+		}
+		if entry.Action != "" {
+			attrs = append(attrs, str("code.function", entry.Action))
+		}
+		if entry.UserID != "" {
+			attrs = append(attrs, str("enduser.id", entry.UserID))
+		}
+	}
+
+	if entry.Exception != "" {
+		attrs = append(attrs, str("exception.message", entry.Exception))
+	}
+	if len(entry.NPlusOne) > 0 {
+		attrs = append(attrs, integer("laravel.n_plus_one", int64(len(entry.NPlusOne))))
+	}
+	return attrs
+}
+
+// validID keeps a hex id of the right length (in hex digits) or makes a new one
+func validID(id string, length int) string {
+	if len(id) == length {
+		if _, err := hex.DecodeString(id); err == nil {
+			return id
+		}
+	}
+	return randomID(length / 2)
+}
+
+func randomID(bytes int) string {
+	b := make([]byte, bytes)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// durationHistograms aggregates a batch into delta histograms of request and
+// job / command durations, one data point per attribute set
+func durationHistograms(entries []laravel.PerformanceEntry, routes []string, start, now time.Time) []metric {
+	type point struct {
+		attrs  []keyValue
+		values []float64
+	}
+	requests := make(map[string]*point)
+	jobs := make(map[string]*point)
+	var requestOrder, jobOrder []string
+
+	for i, e := range entries {
+		seconds := e.DurationMS / 1000
+
+		if e.EntryKind() == laravel.KindRequest {
+			key := e.Method + " " + routes[i] + " " + strconv.Itoa(e.Status)
+			p, ok := requests[key]
+			if !ok {
+				p = &point{attrs: []keyValue{
+					str("http.request.method", e.Method),
+					str("http.route", routes[i]),
+					integer("http.response.status_code", int64(e.Status)),
+				}}
+				requests[key] = p
+				requestOrder = append(requestOrder, key)
+			}
+			p.values = append(p.values, seconds)
+			continue
+		}
+
+		key := e.EntryKind() + " " + e.Name + " " + strconv.FormatBool(e.Failed)
+		p, ok := jobs[key]
+		if !ok {
+			p = &point{attrs: []keyValue{
+				str("laravel.kind", e.EntryKind()),
+				str("laravel.name", e.Name),
+				boolean("laravel.failed", e.Failed),
+			}}
+			jobs[key] = p
+			jobOrder = append(jobOrder, key)
+		}
+		p.values = append(p.values, seconds)
+	}
+
+	toPoints := func(points map[string]*point, order []string) []histogramPoint {
+		result := make([]histogramPoint, 0, len(order))
+		for _, key := range order {
+			p := points[key]
+			hp := histogramPoint{
+				Attributes:        p.attrs,
+				StartTimeUnixNano: nanos(start),
+				TimeUnixNano:      nanos(now),
+				Count:             strconv.Itoa(len(p.values)),
+				ExplicitBounds:    telemetry.DurationBuckets,
+				Min:               p.values[0],
+				Max:               p.values[0],
+			}
+			counts := make([]int, len(telemetry.DurationBuckets)+1)
+			for _, v := range p.values {
+				hp.Sum += v
+				if v < hp.Min {
+					hp.Min = v
+				}
+				if v > hp.Max {
+					hp.Max = v
+				}
+				bucket := len(telemetry.DurationBuckets)
+				for b, bound := range telemetry.DurationBuckets {
+					if v <= bound {
+						bucket = b
+						break
+					}
+				}
+				counts[bucket]++
+			}
+			for _, c := range counts {
+				hp.BucketCounts = append(hp.BucketCounts, strconv.Itoa(c))
+			}
+			result = append(result, hp)
+		}
+		return result
+	}
+
+	var metrics []metric
+	if len(requestOrder) > 0 {
+		metrics = append(metrics, metric{
+			Name:        "http.server.request.duration",
+			Unit:        "s",
+			Description: "Duration of HTTP server requests",
+			Histogram:   &histogram{DataPoints: toPoints(requests, requestOrder), AggregationTemporality: temporalityDelta},
+		})
+	}
+	if len(jobOrder) > 0 {
+		metrics = append(metrics, metric{
+			Name:        "laravel.job.duration",
+			Unit:        "s",
+			Description: "Duration of queue jobs and artisan commands",
+			Histogram:   &histogram{DataPoints: toPoints(jobs, jobOrder), AggregationTemporality: temporalityDelta},
+		})
+	}
+	return metrics
+}
@@ -0,0 +1,233 @@
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/config"
+	"github.com/mike/sentinel-agent/pkg/laravel"
+)
+
+const (
+	queueSize  = 10000 // Entries buffered while a batch is being sent or retried
+	maxBackoff = 30 * time.Second
+)
+
+// Exporter sends ingested entries to an OTLP/HTTP collector in batches.
+// Export never blocks ingestion: when the queue is full the entry is dropped.
+type Exporter struct {
+	cfg       config.OTLPConfig
+	client    *http.Client
+	queue     chan laravel.PerformanceEntry
+	normalize func(projectPath, method, uri string) string
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// Stats counts exported entries, for /runner/status
+type Stats struct {
+	Exported  uint64 `json:"exported"`
+	Dropped   uint64 `json:"dropped"` // Queue full
+	Failed    uint64 `json:"failed"`  // Given up on after retries
+	LastError string `json:"last_error,omitempty"`
+}
+
+// New creates an exporter. normalize maps a URI to its route pattern (http.route).
+func New(cfg config.OTLPConfig, normalize func(projectPath, method, uri string) string) *Exporter {
+	return &Exporter{
+		cfg:       cfg,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		queue:     make(chan laravel.PerformanceEntry, queueSize),
+		normalize: normalize,
+	}
+}
+
+// Export queues an entry for the next batch
+func (e *Exporter) Export(entry laravel.PerformanceEntry) {
+	select {
+	case e.queue <- entry:
+	default:
+		e.mu.Lock()
+		e.stats.Dropped++
+		e.mu.Unlock()
+	}
+}
+
+func (e *Exporter) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats
+}
+
+// Run batches queued entries until ctx is done, flushing when a batch is full
+// or the flush interval elapses.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(e.cfg.FlushIntervalMS) * time.Millisecond)
+	defer ticker.Stop()
+
+	batch := make([]laravel.PerformanceEntry, 0, e.cfg.BatchSize)
+	batchStart := time.Now()
+
+	flush := func() {
+		if len(batch) > 0 {
+			e.send(ctx, batch, batchStart)
+		}
+		batch = batch[:0]
+		batchStart = time.Now()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Best effort on shutdown, without retries
+			e.send(context.Background(), batch, batchStart)
+			return
+		case entry := <-e.queue:
+			batch = append(batch, entry)
+			if len(batch) >= e.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// send exports one batch as traces and, when enabled, metrics
+func (e *Exporter) send(ctx context.Context, batch []laravel.PerformanceEntry, batchStart time.Time) {
+	if len(batch) == 0 {
+		return
+	}
+
+	routes := make([]string, len(batch))
+	for i, entry := range batch {
+		routes[i] = e.normalize(entry.Project, entry.Method, entry.URI)
+	}
+
+	// 1. Group by project: each project is its own service (resource)
+	var projects []string
+	byProject := make(map[string][]int)
+	for i, entry := range batch {
+		if _, ok := byProject[entry.Project]; !ok {
+			projects = append(projects, entry.Project)
+		}
+		byProject[entry.Project] = append(byProject[entry.Project], i)
+	}
+
+	// 2. Traces
+	traces := exportTraceRequest{}
+	for _, projectPath := range projects {
+		var spans []span
+		for _, i := range byProject[projectPath] {
+			spans = append(spans, spansFor(batch[i], routes[i])...)
+		}
+		traces.ResourceSpans = append(traces.ResourceSpans, resourceSpans{
+			Resource:   resourceFor(projectPath, e.cfg.ServiceName),
+			ScopeSpans: []scopeSpans{{Scope: scope{Name: scopeName}, Spans: spans}},
+		})
+	}
+	err := e.post(ctx, "/v1/traces", traces)
+
+	// 3. Metrics
+	if err == nil && e.cfg.Metrics {
+		metrics := exportMetricsRequest{}
+		now := time.Now()
+		for _, projectPath := range projects {
+			var entries []laravel.PerformanceEntry
+			var entryRoutes []string
+			for _, i := range byProject[projectPath] {
+				entries = append(entries, batch[i])
+				entryRoutes = append(entryRoutes, routes[i])
+			}
+			metrics.ResourceMetrics = append(metrics.ResourceMetrics, resourceMetrics{
+				Resource:     resourceFor(projectPath, e.cfg.ServiceName),
+				ScopeMetrics: []scopeMetrics{{Scope: scope{Name: scopeName}, Metrics: durationHistograms(entries, entryRoutes, batchStart, now)}},
+			})
+		}
+		err = e.post(ctx, "/v1/metrics", metrics)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		e.stats.Failed += uint64(len(batch))
+		e.stats.LastError = err.Error()
+		fmt.Printf("[OTLP] Dropped batch of %d: %v\n", len(batch), err)
+		return
+	}
+	e.stats.Exported += uint64(len(batch))
+}
+
+// post sends a gzipped JSON export request, retrying with exponential backoff
+// on network errors and the statuses the OTLP spec marks as retryable.
+func (e *Exporter) post(ctx context.Context, path string, payload interface{}) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(payload); err != nil {
+		return fmt.Errorf("failed to encode export: %v", err)
+	}
+	gz.Close()
+	body := buf.Bytes()
+
+	url := strings.TrimRight(e.cfg.Endpoint, "/") + path
+	backoff := 500 * time.Millisecond
+
+	var lastErr error
+	for attempt := 0; attempt <= e.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return lastErr
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		for key, value := range e.cfg.Headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := e.client.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to reach collector: %v", err)
+			continue
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("collector returned %s for %s", resp.Status, path)
+
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			// Honour the collector's throttling hint
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+				backoff = time.Duration(seconds) * time.Second
+			}
+		default:
+			return lastErr // Not retryable (e.g. 400 for a malformed payload)
+		}
+	}
+	return lastErr
+}
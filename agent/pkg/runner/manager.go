@@ -9,11 +9,12 @@ import (
 
 	_ "embed"
 
+	"github.com/mike/sentinel-agent/pkg/config"
 	"github.com/mike/sentinel-agent/pkg/injector"
 )
 
-//go:embed inspector.php
-var inspectorContent []byte
+//go:embed inspector.php.tmpl
+var inspectorTemplate []byte
 
 type AuditStatus struct {
 	Path      string    `json:"path"`
@@ -27,9 +28,10 @@ type Manager struct {
 	mu       sync.RWMutex
 	injector *injector.Injector
 	baseDir  string // ~/.sentinel
+	config   *config.Config
 }
 
-func NewManager() *Manager {
+func NewManager(cfg *config.Config) *Manager {
 	home, _ := os.UserHomeDir()
 	baseDir := filepath.Join(home, ".sentinel")
 	os.MkdirAll(baseDir, 0755)
@@ -37,7 +39,8 @@ func NewManager() *Manager {
 	return &Manager{
 		audits:   make(map[string]*AuditStatus),
 		baseDir:  baseDir,
-		injector: injector.New(inspectorContent),
+		injector: injector.New(inspectorTemplate),
+		config:   cfg,
 	}
 }
 
@@ -50,7 +53,8 @@ func (m *Manager) EnableAudit(projectPath string) error {
 		return fmt.Errorf("audit already active for this project")
 	}
 
-	if err := m.injector.EnableAudit(projectPath); err != nil {
+	settings := injector.SettingsFor(m.config, projectPath)
+	if err := m.injector.EnableAudit(projectPath, settings); err != nil {
 		return fmt.Errorf("failed to inject audit probe: %v", err)
 	}
 
@@ -82,6 +86,18 @@ func (m *Manager) DisableAudit(projectPath string) error {
 	return nil
 }
 
+// ActivePaths lists the projects currently in audit mode
+func (m *Manager) ActivePaths() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	paths := make([]string, 0, len(m.audits))
+	for key := range m.audits {
+		paths = append(paths, key)
+	}
+	return paths
+}
+
 func (m *Manager) GetStatus() map[string]interface{} {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
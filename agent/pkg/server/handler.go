@@ -2,14 +2,25 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mike/sentinel-agent/pkg/config"
+	"github.com/mike/sentinel-agent/pkg/fpm"
 	"github.com/mike/sentinel-agent/pkg/laravel"
+	"github.com/mike/sentinel-agent/pkg/nginx"
+	"github.com/mike/sentinel-agent/pkg/notify"
 	"github.com/mike/sentinel-agent/pkg/project"
+	"github.com/mike/sentinel-agent/pkg/telemetry"
+	"github.com/mike/sentinel-agent/pkg/watchdog"
 )
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -27,6 +38,7 @@ func (s *Server) handleProjects(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.projects.Invalidate() // A refresh should also reach ingest
 	if projects == nil {
 		projects = []project.Project{}
 	}
@@ -38,6 +50,97 @@ func (s *Server) handleTelemetry(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(status)
 }
 
+// handleTelemetryHistory returns sampled system stats over ?range= (default 1h, at most 24h).
+// Ranges up to an hour use 5 second samples, longer ones minute averages.
+func (s *Server) handleTelemetryHistory(w http.ResponseWriter, r *http.Request) {
+	rng := time.Hour
+	if v := r.URL.Query().Get("range"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid range", http.StatusBadRequest)
+			return
+		}
+		rng = d
+	}
+
+	samples, resolution := s.History.Range(rng)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"resolution_seconds": resolution.Seconds(),
+		"samples":            samples,
+	})
+}
+
+// handleTelemetryFpm returns the FPM pool status page, including what each worker is serving.
+// 502 when FPM can't be reached; 503 when it answers but pm.status_path isn't enabled.
+func (s *Server) handleTelemetryFpm(w http.ResponseWriter, r *http.Request) {
+	status, err := s.Monitor.FpmStatus()
+	if err != nil {
+		code := http.StatusBadGateway
+		var respErr *fpm.ResponseError
+		if errors.As(err, &respErr) {
+			code = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	if r.URL.Query().Get("busy") == "true" {
+		busy := []fpm.Worker{}
+		for _, wk := range status.Workers {
+			if wk.Busy() {
+				busy = append(busy, wk)
+			}
+		}
+		status.Workers = busy
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleTelemetryProcesses lists running PHP processes, busiest first, each
+// mapped to the discovered project it runs in (by cwd, or the artisan path)
+func (s *Server) handleTelemetryProcesses(w http.ResponseWriter, r *http.Request) {
+	procs := s.Monitor.GetProcesses()
+	if procs == nil {
+		procs = []telemetry.PHPProcess{}
+	}
+
+	projects := s.projects.Projects()
+	for i := range procs {
+		procs[i].Project = projectFor(projects, procs[i])
+	}
+
+	sort.SliceStable(procs, func(i, j int) bool {
+		return procs[i].CpuPercent > procs[j].CpuPercent
+	})
+	json.NewEncoder(w).Encode(procs)
+}
+
+// projectFor returns the path of the innermost project containing the
+// process's cwd or the artisan script on its command line
+func projectFor(projects []project.Project, p telemetry.PHPProcess) string {
+	candidates := []string{p.Cwd}
+	for _, arg := range strings.Fields(p.Cmdline) {
+		if filepath.Base(arg) == "artisan" && filepath.IsAbs(arg) {
+			candidates = append(candidates, filepath.Dir(arg))
+		}
+	}
+
+	best := ""
+	for _, c := range candidates {
+		if c == "" {
+			continue
+		}
+		c = filepath.Clean(c)
+		for _, proj := range projects {
+			root := filepath.Clean(proj.Path)
+			if (c == root || strings.HasPrefix(c, root+string(filepath.Separator))) && len(root) > len(best) {
+				best = proj.Path
+			}
+		}
+	}
+	return best
+}
+
 func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		var newConfig config.Config
@@ -45,6 +148,26 @@ func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid config", http.StatusBadRequest)
 			return
 		}
+		for _, rule := range newConfig.Rules {
+			if err := watchdog.ValidateRule(rule); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid rule %q: %v", watchdog.RuleKey(rule), err), http.StatusBadRequest)
+				return
+			}
+		}
+		if _, err := nginx.ParseFormat(newConfig.NginxLogFormat); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid nginx log format: %v", err), http.StatusBadRequest)
+			return
+		}
+		for _, sink := range newConfig.NotificationSinks {
+			if err := notify.Validate(sink); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid notification sink %q: %v", sink.Name, err), http.StatusBadRequest)
+				return
+			}
+			if !s.knownCommandSink(sink) {
+				http.Error(w, fmt.Sprintf("Notification sink %q: command sinks can only be added or changed in sentinel-config.json", sink.Name), http.StatusForbidden)
+				return
+			}
+		}
 
 		// Update fields
 		s.Config.Host = newConfig.Host
@@ -53,6 +176,20 @@ func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 		s.Config.IgnoredProjects = newConfig.IgnoredProjects
 		s.Config.CpuThreshold = newConfig.CpuThreshold
 		s.Config.NginxLogPath = newConfig.NginxLogPath
+		s.Config.NginxLogFormat = newConfig.NginxLogFormat
+		s.Config.PhpFpmAddress = newConfig.PhpFpmAddress
+		s.Config.PhpFpmStatusPath = newConfig.PhpFpmStatusPath
+		s.Config.MetricsRetentionHours = newConfig.MetricsRetentionHours
+		s.Config.MetricsMaxSizeMB = newConfig.MetricsMaxSizeMB
+		s.Config.NPlusOneThreshold = newConfig.NPlusOneThreshold
+		s.Config.Probe = newConfig.Probe
+		s.Config.ProbeOverrides = newConfig.ProbeOverrides
+		s.Config.IngestRateLimit = newConfig.IngestRateLimit
+		s.Config.SpoolPath = newConfig.SpoolPath
+		s.Config.SocketPath = newConfig.SocketPath
+		s.Config.OTLP = newConfig.OTLP
+		s.Config.Rules = newConfig.Rules
+		s.Config.NotificationSinks = newConfig.NotificationSinks
 
 		if err := s.Config.Save(); err != nil {
 			http.Error(w, "Failed to save config", http.StatusInternalServerError)
@@ -67,6 +204,23 @@ func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(s.Config)
 }
 
+// knownCommandSink reports whether a sink from a /config POST may be saved. The
+// API is unauthenticated and open to any origin, so a command sink must already
+// exist with the same command and arguments: running commands is only
+// configured by editing the config file on disk.
+func (s *Server) knownCommandSink(sink config.SinkConfig) bool {
+	if sink.Type != config.SinkCommand {
+		return true
+	}
+	for _, current := range s.Config.NotificationSinks {
+		if current.Name == sink.Name && current.Type == config.SinkCommand &&
+			current.Command == sink.Command && slices.Equal(current.Args, sink.Args) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Server) handleRestart(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -102,7 +256,24 @@ func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	logs, err := laravel.GetRecentLogs(projectPath, 50) // Default to 50 lines
+	// ?channel=name targets one channel, ?channel=all merges every log file
+	channel := r.URL.Query().Get("channel")
+
+	// ?format=entries returns parsed Monolog records instead of raw lines
+	if r.URL.Query().Get("format") == "entries" {
+		entries, err := laravel.GetRecentEntries(projectPath, channel, 50) // Default to 50 entries
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if entries == nil {
+			entries = []laravel.LogEntry{}
+		}
+		json.NewEncoder(w).Encode(entriesWrapper{Entries: entries})
+		return
+	}
+
+	logs, err := laravel.GetRecentLogs(projectPath, channel, 50) // Default to 50 lines
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -110,10 +281,98 @@ func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(linesWrapper{Lines: logs})
 }
 
+// handleLogChannels lists the log files under storage/logs grouped by channel.
+// ?configured=true also reads config/logging.php through artisan.
+func (s *Server) handleLogChannels(w http.ResponseWriter, r *http.Request) {
+	projectPath := r.URL.Query().Get("path")
+	if projectPath == "" {
+		http.Error(w, "Missing 'path' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	var channels []laravel.LogChannel
+	var err error
+	if r.URL.Query().Get("configured") == "true" {
+		channels, err = laravel.DiscoverConfiguredChannels(projectPath)
+	} else {
+		channels, err = laravel.DiscoverChannels(projectPath)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if channels == nil {
+		channels = []laravel.LogChannel{}
+	}
+	json.NewEncoder(w).Encode(channels)
+}
+
+// handleLogStream pushes new log entries as Server-Sent Events.
+// Optional filters: ?level=error,critical&q=keyword&channel=name
+func (s *Server) handleLogStream(w http.ResponseWriter, r *http.Request) {
+	projectPath := r.URL.Query().Get("path")
+	if projectPath == "" {
+		http.Error(w, "Missing 'path' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	channel := r.URL.Query().Get("channel")
+	if channel == laravel.AllChannels {
+		http.Error(w, "Streaming follows a single channel", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	filter := laravel.LogFilter{Keyword: r.URL.Query().Get("q")}
+	if levels := r.URL.Query().Get("level"); levels != "" {
+		filter.Levels = strings.Split(levels, ",")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx := r.Context()
+	entries := make(chan laravel.LogEntry, 64)
+	go laravel.StreamEntries(ctx, projectPath, channel, filter, entries)
+
+	// Comment lines keep proxies from closing an idle stream
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case entry := <-entries:
+			data, err := json.Marshal(entry)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
+
 type linesWrapper struct {
 	Lines []string `json:"lines"`
 }
 
+type entriesWrapper struct {
+	Entries []laravel.LogEntry `json:"entries"`
+}
+
 type ProxyRequest struct {
 	Method  string            `json:"method"`
 	URL     string            `json:"url"`
@@ -215,30 +474,76 @@ func (s *Server) handleRunnerStop(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleRunnerStatus(w http.ResponseWriter, r *http.Request) {
 	status := s.Runner.GetStatus()
+	status["ingest"] = s.ingest.Stats() // Accepted/dropped counters for the ingest endpoint
+	if s.OTLP != nil {
+		status["otlp"] = s.OTLP.Stats()
+	}
 	json.NewEncoder(w).Encode(status)
 }
 
 // Ingest Handler (for Direct Telemetry)
+// Accepts a single JSON entry, a JSON array or an application/x-ndjson body,
+// optionally gzip-encoded. Batches get per-item results instead of a status code.
 func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var entry laravel.PerformanceEntry
-	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+	items, batch, err := decodeIngestBody(r)
+	if err != nil {
 		fmt.Printf("Ingest Decode Error: %v\n", err) // Debug
 		http.Error(w, "Invalid metric", http.StatusBadRequest)
 		return
 	}
 
-	// Add to in-memory store
-	if s.Store != nil {
-		s.Store.Add(entry)
-		fmt.Printf("Ingested: %s %s (%v ms)\n", entry.Method, entry.URI, entry.DurationMS) // DEBUG
+	if !batch {
+		var entry laravel.PerformanceEntry
+		if err := json.Unmarshal(items[0], &entry); err != nil {
+			http.Error(w, "Invalid metric", http.StatusBadRequest)
+			return
+		}
+
+		switch err := s.ingestEntry(entry, true); err {
+		case nil:
+		case errIngestRateLimited:
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	result := batchResult{Errors: []batchItemError{}}
+	for i, item := range items {
+		var entry laravel.PerformanceEntry
+		err := json.Unmarshal(item, &entry)
+		if err == nil {
+			err = s.ingestEntry(entry, true)
+		}
+		if err != nil {
+			result.Rejected++
+			result.Errors = append(result.Errors, batchItemError{Index: i, Error: err.Error()})
+			continue
+		}
+		result.Accepted++
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+type batchResult struct {
+	Accepted int              `json:"accepted"`
+	Rejected int              `json:"rejected"`
+	Errors   []batchItemError `json:"errors"`
+}
+
+type batchItemError struct {
+	Index int    `json:"index"` // Position in the array, or line number (from 0) for NDJSON
+	Error string `json:"error"`
 }
 
 func (s *Server) handlePerformance(w http.ResponseWriter, r *http.Request) {
@@ -249,32 +554,359 @@ func (s *Server) handlePerformance(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 1. Get Logs from File (Standard)
-	metrics, err := laravel.GetPerformanceLogs(projectPath)
+	metrics, err := laravel.GetPerformanceLogs(projectPath, r.URL.Query().Get("channel"))
 	if err != nil {
 		// Just log error and continue, acceptable to have empty file logs
 		fmt.Printf("Error reading log file: %v\n", err)
 		metrics = []laravel.PerformanceEntry{}
 	}
 
-	// 2. Get In-Memory Metrics from Store (Runner)
+	// 2. Get Ingested Metrics from Store (Runner)
+	// ?range=24h or ?from=...&to=... reads persisted history instead of the recent cache
 	if s.Store != nil {
-		memoryMetrics := s.Store.GetAll()
-		metrics = append(metrics, memoryMetrics...)
+		from, to, ok, err := parseTimeWindow(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ok {
+			stored, err := s.Store.Query(projectPath, from, to)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			metrics = append(metrics, stored...)
+		} else {
+			metrics = append(metrics, s.Store.GetAll(projectPath)...)
+		}
+	}
+	// Jobs and commands have their own endpoint (/projects/jobs)
+	metrics = telemetry.FilterKind(metrics, laravel.KindRequest)
+
+	// ?status=5xx or ?status=4xx,500 keeps matching responses only
+	if v := r.URL.Query().Get("status"); v != "" {
+		match, err := parseStatusFilter(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filtered := make([]laravel.PerformanceEntry, 0, len(metrics))
+		for _, m := range metrics {
+			if match(m.Status) {
+				filtered = append(filtered, m)
+			}
+		}
+		metrics = filtered
 	}
 
 	json.NewEncoder(w).Encode(metrics)
 }
 
+// handlePerformanceSummary returns per-route statistics for ingested entries.
+// The window defaults to the last hour; see parseTimeWindow for ?range/?from/?to.
+func (s *Server) handlePerformanceSummary(w http.ResponseWriter, r *http.Request) {
+	projectPath := r.URL.Query().Get("path")
+	if projectPath == "" {
+		http.Error(w, "Missing 'path' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	from, to, ok, err := parseTimeWindow(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		from = time.Now().Add(-1 * time.Hour)
+	}
+
+	entries, err := s.Store.Query(projectPath, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	matcher := s.routes.Matcher(projectPath)
+	entries = telemetry.FilterKind(entries, laravel.KindRequest)
+	json.NewEncoder(w).Encode(telemetry.Summarize(entries, matcher.Normalize))
+}
+
+// handlePerformanceErrors returns the error-rate view of ingested requests (default: last hour).
+// ?bucket=5m sets the timeline resolution (default 1m).
+func (s *Server) handlePerformanceErrors(w http.ResponseWriter, r *http.Request) {
+	projectPath := r.URL.Query().Get("path")
+	if projectPath == "" {
+		http.Error(w, "Missing 'path' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	from, to, ok, err := parseTimeWindow(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		from = time.Now().Add(-1 * time.Hour)
+	}
+
+	bucket := time.Minute
+	if v := r.URL.Query().Get("bucket"); v != "" {
+		if bucket, err = time.ParseDuration(v); err != nil || bucket <= 0 {
+			http.Error(w, "invalid bucket", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := s.Store.Query(projectPath, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	matcher := s.routes.Matcher(projectPath)
+	entries = telemetry.FilterKind(entries, laravel.KindRequest)
+	json.NewEncoder(w).Encode(telemetry.SummarizeErrors(entries, matcher.Normalize, bucket))
+}
+
+// parseStatusFilter reads a comma separated list of status classes ("5xx") or codes ("404")
+func parseStatusFilter(v string) (func(status int) bool, error) {
+	var classes, codes []int
+	for _, part := range strings.Split(v, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if len(part) == 3 && strings.HasSuffix(part, "xx") && part[0] >= '1' && part[0] <= '5' {
+			classes = append(classes, int(part[0]-'0'))
+			continue
+		}
+		code, err := strconv.Atoi(part)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status: %s (expected e.g. 5xx or 404)", part)
+		}
+		codes = append(codes, code)
+	}
+
+	return func(status int) bool {
+		for _, c := range classes {
+			if status/100 == c {
+				return true
+			}
+		}
+		for _, c := range codes {
+			if status == c {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// handleNPlusOne lists repeated-query findings per route over a window (default: last hour)
+func (s *Server) handleNPlusOne(w http.ResponseWriter, r *http.Request) {
+	projectPath := r.URL.Query().Get("path")
+	if projectPath == "" {
+		http.Error(w, "Missing 'path' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	from, to, ok, err := parseTimeWindow(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		from = time.Now().Add(-1 * time.Hour)
+	}
+
+	entries, err := s.Store.Query(projectPath, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	matcher := s.routes.Matcher(projectPath)
+	json.NewEncoder(w).Encode(telemetry.FindNPlusOne(entries, func(method, uri string) string {
+		// Job and command names are already stable
+		if method == "JOB" || method == "CLI" {
+			return uri
+		}
+		return matcher.Normalize(method, uri)
+	}))
+}
+
+// handleTraces lists the newest traces of a project (?limit=, default 50)
+func (s *Server) handleTraces(w http.ResponseWriter, r *http.Request) {
+	projectPath := r.URL.Query().Get("path")
+	if projectPath == "" {
+		http.Error(w, "Missing 'path' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	json.NewEncoder(w).Encode(s.Traces.List(projectPath, limit))
+}
+
+// handleTrace returns the span tree of /projects/traces/{id}
+func (s *Server) handleTrace(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/projects/traces/")
+	if id == "" {
+		s.handleTraces(w, r)
+		return
+	}
+
+	trace, err := s.Traces.Get(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if trace == nil {
+		http.Error(w, "Trace not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(trace)
+}
+
+// handleJobs lists queue job and artisan command entries.
+// ?kind=job or ?kind=command narrows the list; see parseTimeWindow for ?range/?from/?to.
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	projectPath := r.URL.Query().Get("path")
+	if projectPath == "" {
+		http.Error(w, "Missing 'path' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	kinds, err := parseJobKinds(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	from, to, ok, err := parseTimeWindow(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var entries []laravel.PerformanceEntry
+	if ok {
+		entries, err = s.Store.Query(projectPath, from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		entries = s.Store.GetAll(projectPath)
+	}
+
+	json.NewEncoder(w).Encode(telemetry.FilterKind(entries, kinds...))
+}
+
+// handleJobsSummary returns per job class / command statistics (default: last hour)
+func (s *Server) handleJobsSummary(w http.ResponseWriter, r *http.Request) {
+	projectPath := r.URL.Query().Get("path")
+	if projectPath == "" {
+		http.Error(w, "Missing 'path' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	kinds, err := parseJobKinds(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	from, to, ok, err := parseTimeWindow(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		from = time.Now().Add(-1 * time.Hour)
+	}
+
+	entries, err := s.Store.Query(projectPath, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entries = telemetry.FilterKind(entries, kinds...)
+	json.NewEncoder(w).Encode(telemetry.Summarize(entries, func(_, name string) string { return name }))
+}
+
+// parseJobKinds reads ?kind=job|command, defaulting to both
+func parseJobKinds(r *http.Request) ([]string, error) {
+	switch kind := r.URL.Query().Get("kind"); kind {
+	case "":
+		return []string{laravel.KindJob, laravel.KindCommand}, nil
+	case laravel.KindJob, laravel.KindCommand:
+		return []string{kind}, nil
+	default:
+		return nil, fmt.Errorf("invalid kind: %s (expected job or command)", kind)
+	}
+}
+
+// parseTimeWindow reads ?range=<duration> or ?from=&to= (RFC 3339 or "Y-m-d H:i:s").
+// ok is false when no window was requested.
+func parseTimeWindow(r *http.Request) (from, to time.Time, ok bool, err error) {
+	q := r.URL.Query()
+
+	if rng := q.Get("range"); rng != "" {
+		d, err := time.ParseDuration(rng)
+		if err != nil {
+			return from, to, false, fmt.Errorf("invalid range: %v", err)
+		}
+		return time.Now().Add(-d), time.Time{}, true, nil
+	}
+
+	parse := func(v string) (time.Time, error) {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, nil
+		}
+		return time.ParseInLocation("2006-01-02 15:04:05", v, time.Local)
+	}
+
+	if v := q.Get("from"); v != "" {
+		if from, err = parse(v); err != nil {
+			return from, to, false, fmt.Errorf("invalid from: %v", err)
+		}
+		ok = true
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = parse(v); err != nil {
+			return from, to, false, fmt.Errorf("invalid to: %v", err)
+		}
+		ok = true
+	}
+	return from, to, ok, nil
+}
+
 func (s *Server) handlePerformanceClear(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	projectPath := r.URL.Query().Get("path")
+	if projectPath == "" {
+		http.Error(w, "Missing 'path' query parameter", http.StatusBadRequest)
+		return
+	}
+
 	if s.Store != nil {
-		s.Store.Clear()
+		s.Store.Clear(projectPath)
+	}
+	if s.Traces != nil {
+		s.Traces.Clear(projectPath)
 	}
-	// Also could truncate log file if we wanted, but for now just clear memory
+	// Also could truncate log file if we wanted, but for now just clear the store
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -284,6 +916,11 @@ func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
+	if r.URL.Query().Get("all") == "true" {
+		json.NewEncoder(w).Encode(s.Watchdog.Active())
+		return
+	}
+
 	incident := s.Watchdog.GetLatest()
 	if incident == nil {
 		w.WriteHeader(http.StatusNoContent) // 204 No Content
@@ -292,6 +929,81 @@ func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(incident)
 }
 
+// handleAlertHistory lists logged incidents, newest first.
+// ?state=open|acknowledged|resolved filters, ?limit= caps the list (default 100).
+func (s *Server) handleAlertHistory(w http.ResponseWriter, r *http.Request) {
+	if s.Watchdog == nil {
+		json.NewEncoder(w).Encode([]watchdog.Incident{})
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	switch state {
+	case "", watchdog.StateOpen, watchdog.StateAcknowledged, watchdog.StateResolved:
+	default:
+		http.Error(w, "invalid state", http.StatusBadRequest)
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	json.NewEncoder(w).Encode(s.Watchdog.History(state, limit))
+}
+
+// handleAlertSinks reports delivery counts per notification sink
+func (s *Server) handleAlertSinks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.Notify.Stats())
+}
+
+// handleAlertSinksTest sends a test incident to ?name= (every sink when omitted)
+// and reports each outcome
+func (s *Server) handleAlertSinksTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	results := s.Notify.Test(r.Context(), name)
+	if name != "" && len(results) == 0 {
+		http.Error(w, "Sink not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(results)
+}
+
+// handleAlertAck acknowledges an incident: POST /alerts/{id}/ack
+func (s *Server) handleAlertAck(w http.ResponseWriter, r *http.Request) {
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/alerts/"), "/ack")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.Watchdog == nil {
+		http.Error(w, "Incident not found", http.StatusNotFound)
+		return
+	}
+
+	incident, err := s.Watchdog.Acknowledge(id)
+	if errors.Is(err, watchdog.ErrIncidentNotFound) {
+		http.Error(w, "Incident not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(incident)
+}
+
 func (s *Server) handleDeadlocks(w http.ResponseWriter, r *http.Request) {
 	projectPath := r.URL.Query().Get("path")
 	if projectPath == "" {
@@ -299,7 +1011,7 @@ func (s *Server) handleDeadlocks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deadlocks, err := laravel.GetDeadlocks(projectPath)
+	deadlocks, err := laravel.GetDeadlocks(projectPath, r.URL.Query().Get("channel"))
 	if err != nil {
 		// Return empty list on error to avoid breaking UI (e.g. log file missing)
 		deadlocks = []laravel.DeadlockEntry{}
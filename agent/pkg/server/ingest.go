@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/mike/sentinel-agent/pkg/ingest"
+	"github.com/mike/sentinel-agent/pkg/laravel"
+	"github.com/mike/sentinel-agent/pkg/project"
+	"github.com/mike/sentinel-agent/pkg/telemetry"
+)
+
+var (
+	errIngestRateLimited = errors.New("ingest rate limit exceeded")
+	errUnknownProject    = errors.New("unknown project")
+)
+
+// ingestEntry validates an entry from any transport and adds it to the store.
+// limited is false for spool lines: they are already buffered on disk, and
+// dropping a backlog replayed after a restart would lose what the spool kept.
+func (s *Server) ingestEntry(entry laravel.PerformanceEntry, limited bool) error {
+	// Only accept metrics for known projects, keyed by their discovered path
+	projectPath, ok := s.resolveProject(entry.Project)
+	if !ok {
+		return errUnknownProject
+	}
+	entry.Project = projectPath
+
+	// Shed load under bursts (e.g. load tests with audit mode on).
+	// Charged after validation so rejected entries don't count as accepted.
+	if !limited {
+		s.ingest.Accept(1)
+	} else if !s.ingest.Allow(1) {
+		return errIngestRateLimited
+	}
+
+	entry.NPlusOne = telemetry.DetectNPlusOne(entry.QueryFingerprints, s.Config.NPlusOneThreshold)
+
+	// Exported with its spans, before they move to the trace store
+	if s.OTLP != nil {
+		s.OTLP.Export(entry)
+	}
+
+	// Spans live in the trace store; the entry keeps the id to link to them
+	if len(entry.Spans) > 0 {
+		if err := s.Traces.Add(telemetry.TraceFromEntry(entry)); err != nil {
+			fmt.Printf("[Traces] Dropped trace: %v\n", err)
+			entry.TraceID = ""
+		}
+		entry.Spans = nil
+	}
+
+	// Add to store
+	if s.Store != nil {
+		s.Store.Add(entry)
+		s.histograms.Observe(entry)
+	}
+	return nil
+}
+
+// Upper bound for one (decompressed) ingest body
+const maxIngestBody = 32 * 1024 * 1024
+
+// decodeIngestBody splits a request body into raw entries.
+// batch is false for the classic single-object body.
+func decodeIngestBody(r *http.Request) (items []json.RawMessage, batch bool, err error) {
+	var body io.Reader = r.Body
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid gzip body: %v", err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxIngestBody+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) > maxIngestBody {
+		return nil, false, fmt.Errorf("body exceeds %d bytes", maxIngestBody)
+	}
+
+	// NDJSON: one entry per non-empty line. Blank lines keep their index so
+	// errors point at the right line.
+	if strings.Contains(r.Header.Get("Content-Type"), "ndjson") {
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			items = append(items, json.RawMessage(bytes.TrimSpace(line)))
+		}
+		// Drop the empty item produced by a trailing newline
+		if len(items) > 0 && len(items[len(items)-1]) == 0 {
+			items = items[:len(items)-1]
+		}
+		return items, true, nil
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, false, err
+		}
+		return items, true, nil
+	}
+
+	if !json.Valid(trimmed) {
+		return nil, false, fmt.Errorf("invalid JSON body")
+	}
+	return []json.RawMessage{trimmed}, false, nil
+}
+
+// startTransports runs the non-blocking probe transports alongside HTTP ingest
+func (s *Server) startTransports(ctx context.Context) {
+	handle := func(limited bool) ingest.Handler {
+		return func(entry laravel.PerformanceEntry) {
+			if err := s.ingestEntry(entry, limited); err != nil {
+				fmt.Printf("[Ingest] Dropped %s %s: %v\n", entry.Method, entry.URI, err)
+			}
+		}
+	}
+
+	go ingest.TailSpool(ctx, s.Config.SpoolPath, handle(false))
+
+	go func() {
+		if err := ingest.ListenSocket(ctx, s.Config.SocketPath, handle(true)); err != nil {
+			fmt.Printf("[Socket] Stopped: %v\n", err)
+		}
+	}()
+}
+
+// resolveProject maps a project root reported by the inspector to an audited or
+// discovered project path. Symlinks are resolved so /var/www -> /home/... still matches.
+func (s *Server) resolveProject(reported string) (string, bool) {
+	if reported == "" {
+		return "", false
+	}
+	reported = filepath.Clean(reported)
+	reportedReal, err := filepath.EvalSymlinks(reported)
+	if err != nil {
+		reportedReal = reported
+	}
+
+	matches := func(candidate string) bool {
+		if candidate == reported {
+			return true
+		}
+		real, err := filepath.EvalSymlinks(candidate)
+		return err == nil && real == reportedReal
+	}
+
+	// 1. Projects in audit mode (cheap, the common case)
+	for _, path := range s.Runner.ActivePaths() {
+		if matches(path) {
+			return path, true
+		}
+	}
+
+	// 2. Any discovered project, re-discovering once in case it's new
+	if path, ok := findProject(s.projects.Projects(), matches); ok {
+		return path, true
+	}
+	return findProject(s.projects.Reload(), matches)
+}
+
+func findProject(projects []project.Project, matches func(string) bool) (string, bool) {
+	for _, p := range projects {
+		if matches(p.Path) {
+			return p.Path, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/laravel"
+	"github.com/mike/sentinel-agent/pkg/telemetry"
+)
+
+// Fold queued observations at least this often, even without scrapes
+const histogramFoldInterval = 30 * time.Second
+
+// promWriter writes the Prometheus text exposition format (version 0.0.4)
+type promWriter struct {
+	w *bufio.Writer
+}
+
+type label struct {
+	name, value string
+}
+
+func (p promWriter) header(name, kind, help string) {
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (p promWriter) sample(name string, value float64, labels ...label) {
+	p.w.WriteString(name)
+	if len(labels) > 0 {
+		p.w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				p.w.WriteByte(',')
+			}
+			fmt.Fprintf(p.w, `%s="%s"`, l.name, escapeLabel(l.value))
+		}
+		p.w.WriteByte('}')
+	}
+	p.w.WriteByte(' ')
+	p.w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	p.w.WriteByte('\n')
+}
+
+// Single-sample metrics
+func (p promWriter) gauge(name, help string, value float64, labels ...label) {
+	p.header(name, "gauge", help)
+	p.sample(name, value, labels...)
+}
+
+func (p promWriter) counter(name, help string, value float64, labels ...label) {
+	p.header(name, "counter", help)
+	p.sample(name, value, labels...)
+}
+
+func (p promWriter) histogram(name string, h telemetry.DurationHistogram, labels []label) {
+	for i, bound := range telemetry.DurationBuckets {
+		le := label{"le", strconv.FormatFloat(bound, 'g', -1, 64)}
+		p.sample(name+"_bucket", float64(h.Buckets[i]), append(labels, le)...)
+	}
+	p.sample(name+"_bucket", float64(h.Count), append(labels, label{"le", "+Inf"})...)
+	p.sample(name+"_sum", h.Sum, labels...)
+	p.sample(name+"_count", float64(h.Count), labels...)
+}
+
+func escapeLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return strings.ReplaceAll(v, "\n", `\n`)
+}
+
+// handleMetrics exposes agent, PHP process and ingest stats for Prometheus
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	status := s.Monitor.GetStatus()
+	stats := status.SystemStats
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	s.foldHistograms()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	p := promWriter{w: bw}
+
+	// 1. PHP processes
+	up := 0.0
+	if status.PhpFpm {
+		up = 1
+	}
+	p.gauge("sentinel_php_fpm_up", "Whether PHP-FPM is running.", up)
+	p.gauge("sentinel_php_fpm_cpu_percent", "CPU usage of all PHP-FPM workers, in percent of one core.", stats.PhpFpmCpuPercent)
+	p.gauge("sentinel_php_fpm_workers", "Number of PHP-FPM processes.", float64(stats.PhpFpmWorkerCount))
+	p.header("sentinel_php_memory_bytes", "gauge", "Resident memory of PHP processes by role.")
+	p.sample("sentinel_php_memory_bytes", float64(stats.PhpWebMemoryMB)*1024*1024, label{"role", "web"})
+	p.sample("sentinel_php_memory_bytes", float64(stats.PhpCliMemoryMB)*1024*1024, label{"role", "cli"})
+
+	if fpm := status.PhpFpmStatus; fpm != nil {
+		pool := label{"pool", fpm.Pool}
+		p.gauge("sentinel_php_fpm_active_processes", "Workers serving a request, from the FPM status page.", float64(fpm.ActiveProcesses), pool)
+		p.gauge("sentinel_php_fpm_idle_processes", "Idle workers, from the FPM status page.", float64(fpm.IdleProcesses), pool)
+		p.gauge("sentinel_php_fpm_listen_queue", "Connections waiting for a free worker.", float64(fpm.ListenQueue), pool)
+		p.counter("sentinel_php_fpm_accepted_connections_total", "Connections accepted by the pool.", float64(fpm.AcceptedConn), pool)
+		p.counter("sentinel_php_fpm_max_children_reached_total", "Times pm.max_children kept the pool from spawning a worker.", float64(fpm.MaxChildrenReached), pool)
+		p.counter("sentinel_php_fpm_slow_requests_total", "Requests slower than request_slowlog_timeout.", float64(fpm.SlowRequests), pool)
+	}
+
+	// 2. Agent
+	p.gauge("sentinel_agent_heap_bytes", "Heap memory allocated by the agent.", float64(ms.HeapAlloc))
+	p.gauge("sentinel_agent_goroutines", "Goroutines running in the agent.", float64(stats.NumGoroutine))
+
+	// 3. Ingest
+	ingest := s.ingest.Stats()
+	p.counter("sentinel_ingest_accepted_total", "Entries accepted by the ingest pipeline.", float64(ingest.Accepted))
+	p.counter("sentinel_ingest_dropped_total", "Entries dropped by the ingest rate limit.", float64(ingest.Dropped))
+	p.gauge("sentinel_ingest_rate_limit", "Entries accepted per second before dropping (0 is unlimited).", float64(ingest.LimitPerSecond))
+	p.counter("sentinel_histogram_dropped_total", "Entries missing from the duration histograms because folding fell behind.", float64(s.histograms.Dropped()))
+	p.counter("sentinel_histogram_overflow_total", "Entries counted under route=\"other\" because the histogram series limit was reached.", float64(s.histograms.Overflowed()))
+
+	if s.OTLP != nil {
+		otlp := s.OTLP.Stats()
+		p.counter("sentinel_otlp_exported_total", "Entries exported to the OTLP collector.", float64(otlp.Exported))
+		p.counter("sentinel_otlp_dropped_total", "Entries dropped because the export queue was full.", float64(otlp.Dropped))
+		p.counter("sentinel_otlp_failed_total", "Entries given up on after retries.", float64(otlp.Failed))
+	}
+
+	// 4. Durations per route, job and command
+	snapshot := s.histograms.Snapshot()
+
+	p.header("sentinel_request_duration_seconds", "histogram", "Duration of ingested HTTP requests by route.")
+	for _, h := range snapshot {
+		if h.Kind == laravel.KindRequest {
+			p.histogram("sentinel_request_duration_seconds", h, []label{
+				{"project", h.Project}, {"method", h.Method}, {"route", h.Route}, {"status", h.Status},
+			})
+		}
+	}
+
+	p.header("sentinel_job_duration_seconds", "histogram", "Duration of ingested queue jobs and artisan commands.")
+	for _, h := range snapshot {
+		if h.Kind != laravel.KindRequest {
+			p.histogram("sentinel_job_duration_seconds", h, []label{
+				{"project", h.Project}, {"kind", h.Kind}, {"name", h.Route}, {"status", h.Status},
+			})
+		}
+	}
+}
+
+// foldHistograms normalizes queued entries into the duration histograms.
+// Requests that match no known route share one series, so 404 scans and
+// slugs don't each add one.
+func (s *Server) foldHistograms() {
+	s.histograms.Fold(func(projectPath, method, uri string) string {
+		matcher := s.routes.Matcher(projectPath)
+		if matcher == nil {
+			return laravel.NormalizeURI(uri) // Routes unavailable; the series cap bounds this
+		}
+		if route, ok := matcher.Match(method, uri); ok {
+			return route
+		}
+		return telemetry.UnmatchedRoute
+	})
+}
+
+func (s *Server) startHistogramLoop() {
+	ticker := time.NewTicker(histogramFoldInterval)
+	for range ticker.C {
+		s.foldHistograms()
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/project"
+)
+
+// Discovery walks the whole workspace, so ingest reuses the result for a while.
+// An unknown project triggers a reload once the list is older than projectReloadAfter,
+// so a freshly created project is accepted without waiting for the TTL.
+const (
+	projectCacheTTL    = 30 * time.Second
+	projectReloadAfter = 5 * time.Second
+)
+
+type projectCache struct {
+	mu       sync.Mutex
+	root     string
+	projects []project.Project
+	loaded   time.Time
+}
+
+func newProjectCache(root string) *projectCache {
+	return &projectCache{root: root}
+}
+
+// Projects returns every discovered project, ignored ones included
+func (c *projectCache) Projects() []project.Project {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.loaded) >= projectCacheTTL {
+		c.load()
+	}
+	return c.projects
+}
+
+// Reload re-discovers projects unless the list is very fresh
+func (c *projectCache) Reload() []project.Project {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.loaded) >= projectReloadAfter {
+		c.load()
+	}
+	return c.projects
+}
+
+// Invalidate makes the next call re-discover projects (e.g. after /projects)
+func (c *projectCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loaded = time.Time{}
+}
+
+func (c *projectCache) load() {
+	// On error the previous list is kept until the next reload
+	if projects, err := project.FindProjects(c.root, nil); err == nil {
+		c.projects = projects
+	}
+	c.loaded = time.Now()
+}
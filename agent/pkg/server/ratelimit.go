@@ -0,0 +1,74 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// ingestLimiter is a token bucket guarding /projects/ingest.
+// It refills at rate tokens per second up to one second of burst.
+type ingestLimiter struct {
+	mu       sync.Mutex
+	rate     float64 // 0 disables limiting
+	tokens   float64
+	last     time.Time
+	accepted uint64
+	dropped  uint64
+}
+
+type ingestStats struct {
+	Accepted       uint64 `json:"accepted"`
+	Dropped        uint64 `json:"dropped"`
+	LimitPerSecond int    `json:"limit_per_second"`
+}
+
+func newIngestLimiter(perSecond int) *ingestLimiter {
+	return &ingestLimiter{
+		rate:   float64(perSecond),
+		tokens: float64(perSecond),
+		last:   time.Now(),
+	}
+}
+
+// Allow takes n tokens, counting the entries as accepted or dropped
+func (l *ingestLimiter) Allow(n int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate > 0 {
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.rate {
+			l.tokens = l.rate
+		}
+		l.last = now
+
+		if l.tokens < float64(n) {
+			l.dropped += uint64(n)
+			return false
+		}
+		l.tokens -= float64(n)
+	}
+
+	l.accepted += uint64(n)
+	return true
+}
+
+// Accept counts entries that aren't subject to the limit
+func (l *ingestLimiter) Accept(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.accepted += uint64(n)
+}
+
+func (l *ingestLimiter) Stats() ingestStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return ingestStats{
+		Accepted:       l.accepted,
+		Dropped:        l.dropped,
+		LimitPerSecond: int(l.rate),
+	}
+}
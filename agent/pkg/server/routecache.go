@@ -0,0 +1,85 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/laravel"
+)
+
+// route:list boots the whole application, so matchers are reused for a while.
+// A failed listing is retried sooner.
+const (
+	routeCacheTTL = 2 * time.Minute
+	routeRetryTTL = 15 * time.Second
+)
+
+// routeCache loads each project's routes at most once at a time, outside the
+// cache lock, so a slow project never holds up the others
+type routeCache struct {
+	mu       sync.Mutex
+	matchers map[string]*cachedMatcher // Key: ProjectPath
+}
+
+type cachedMatcher struct {
+	ready   chan struct{}         // Closed once the load finished
+	stale   *laravel.RouteMatcher // Previous matcher, served while reloading
+	matcher *laravel.RouteMatcher // Set before ready is closed
+	expires time.Time
+}
+
+func newRouteCache() *routeCache {
+	return &routeCache{matchers: make(map[string]*cachedMatcher)}
+}
+
+// Matcher returns the project's route matcher, or nil if routes can't be listed
+// (callers then fall back to heuristic normalization).
+func (c *routeCache) Matcher(projectPath string) *laravel.RouteMatcher {
+	c.mu.Lock()
+	cached, ok := c.matchers[projectPath]
+	if ok {
+		select {
+		case <-cached.ready:
+			if time.Now().Before(cached.expires) {
+				c.mu.Unlock()
+				return cached.matcher
+			}
+		default:
+			// Another caller is loading: serve the previous matcher, or wait for the first one
+			c.mu.Unlock()
+			if cached.stale != nil {
+				return cached.stale
+			}
+			<-cached.ready
+			return cached.matcher
+		}
+	}
+
+	load := &cachedMatcher{ready: make(chan struct{})}
+	if ok {
+		load.stale = cached.matcher
+	}
+	c.matchers[projectPath] = load
+	c.mu.Unlock()
+
+	// Refreshes happen in the background while the old matcher keeps serving
+	if load.stale != nil {
+		go c.load(projectPath, load)
+		return load.stale
+	}
+	c.load(projectPath, load)
+	return load.matcher
+}
+
+func (c *routeCache) load(projectPath string, load *cachedMatcher) {
+	defer close(load.ready)
+
+	routes, err := laravel.GetRoutes(projectPath)
+	if err != nil {
+		load.matcher = load.stale // Keep the last good routes until the retry
+		load.expires = time.Now().Add(routeRetryTTL)
+		return
+	}
+	load.matcher = laravel.NewRouteMatcher(routes)
+	load.expires = time.Now().Add(routeCacheTTL)
+}
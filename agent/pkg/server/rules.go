@@ -0,0 +1,286 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/config"
+	"github.com/mike/sentinel-agent/pkg/fpm"
+	"github.com/mike/sentinel-agent/pkg/laravel"
+	"github.com/mike/sentinel-agent/pkg/nginx"
+	"github.com/mike/sentinel-agent/pkg/telemetry"
+	"github.com/mike/sentinel-agent/pkg/watchdog"
+)
+
+// Default look-back for metrics computed from ingested entries and logs
+const defaultRuleWindow = 5 * time.Minute
+
+// ruleValues resolves rule metrics for one watchdog check. Expensive sources
+// (the FPM status page, Store queries, log scans) are read once per check and
+// only when a rule needs them.
+type ruleValues struct {
+	s     *Server
+	stats telemetry.SystemStats
+	now   time.Time
+
+	fpmRead   bool
+	fpmStatus *fpm.Status
+
+	entries map[string][]laravel.PerformanceEntry // Key: project + window
+}
+
+func (s *Server) ruleValues(stats telemetry.SystemStats) *ruleValues {
+	return &ruleValues{
+		s:       s,
+		stats:   stats,
+		now:     time.Now(),
+		entries: make(map[string][]laravel.PerformanceEntry),
+	}
+}
+
+func (v *ruleValues) Value(rule config.Rule) (float64, bool) {
+	switch rule.Metric {
+	case watchdog.MetricFpmCPU:
+		return v.stats.PhpFpmCpuPercent, true
+	case watchdog.MetricFpmWorkers:
+		return float64(v.stats.PhpFpmWorkerCount), true
+	case watchdog.MetricWebMemoryMB:
+		return float64(v.stats.PhpWebMemoryMB), true
+	case watchdog.MetricCliMemoryMB:
+		return float64(v.stats.PhpCliMemoryMB), true
+	case watchdog.MetricAgentMemoryMB:
+		return float64(v.stats.MemoryUsageMB), true
+
+	case watchdog.MetricFpmSaturation:
+		status := v.fpm()
+		if status == nil || status.TotalProcesses == 0 {
+			return 0, false
+		}
+		return float64(status.ActiveProcesses) / float64(status.TotalProcesses) * 100, true
+	case watchdog.MetricFpmListenQueue:
+		status := v.fpm()
+		if status == nil {
+			return 0, false
+		}
+		return float64(status.ListenQueue), true
+
+	case watchdog.MetricP95LatencyMS:
+		entries := v.requests(rule)
+		if len(entries) == 0 {
+			return 0, false
+		}
+		durations := make([]float64, len(entries))
+		for i, e := range entries {
+			durations[i] = e.DurationMS
+		}
+		sort.Float64s(durations)
+		return telemetry.Percentile(durations, 95), true
+	case watchdog.MetricErrorRate:
+		entries := v.requests(rule)
+		if len(entries) == 0 {
+			return 0, false
+		}
+		errors := 0
+		for _, e := range entries {
+			if telemetry.IsError(e) {
+				errors++
+			}
+		}
+		return float64(errors) / float64(len(entries)) * 100, true
+	case watchdog.MetricRequestsPerMin:
+		return float64(len(v.requests(rule))) / ruleWindow(rule).Minutes(), true
+
+	case watchdog.MetricDeadlocks:
+		return float64(v.deadlockCount(rule)), true
+	}
+	return 0, false
+}
+
+func (v *ruleValues) fpm() *fpm.Status {
+	if !v.fpmRead {
+		v.fpmStatus, _ = v.s.Monitor.FpmStatus()
+		v.fpmRead = true
+	}
+	return v.fpmStatus
+}
+
+// Running lists the requests the busy FPM workers are serving, for incident suspects
+func (v *ruleValues) Running() []nginx.Running {
+	status := v.fpm()
+	if status == nil {
+		return nil
+	}
+
+	var running []nginx.Running
+	for _, w := range status.Workers {
+		// One of them is serving the status page we just read
+		path, _, _ := strings.Cut(w.RequestURI, "?")
+		if !w.Busy() || path == "" || path == v.s.Config.PhpFpmStatusPath {
+			continue
+		}
+		running = append(running, nginx.Running{
+			PID:        w.PID,
+			Method:     w.RequestMethod,
+			URI:        w.RequestURI,
+			DurationMS: w.RequestDurationMS,
+		})
+	}
+	return running
+}
+
+// requests returns the ingested requests in the rule's window, for its project or all
+func (v *ruleValues) requests(rule config.Rule) []laravel.PerformanceEntry {
+	window := ruleWindow(rule)
+	key := rule.Project + "\x00" + window.String()
+	if entries, ok := v.entries[key]; ok {
+		return entries
+	}
+
+	var entries []laravel.PerformanceEntry
+	for _, projectPath := range v.projects(rule) {
+		found, err := v.s.Store.Query(projectPath, v.now.Add(-window), v.now)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, telemetry.FilterKind(found, laravel.KindRequest)...)
+	}
+	v.entries[key] = entries
+	return entries
+}
+
+func (v *ruleValues) deadlockCount(rule config.Rule) int {
+	window := ruleWindow(rule)
+	since := v.now.Add(-window)
+
+	count := 0
+	for _, projectPath := range v.projects(rule) {
+		for _, d := range v.s.deadlocks.Get(projectPath, window) {
+			if !d.Time.Before(since) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Deadlock rules rescan the log at most this often. The app timezone, read
+// through artisan, is kept longer; a failed read is retried sooner.
+const (
+	deadlockCacheTTL = 30 * time.Second
+	timezoneCacheTTL = 10 * time.Minute
+	timezoneRetryTTL = 2 * time.Minute
+)
+
+// deadlockCache keeps the lock errors of each project's recent log, so
+// deadlock rules don't rescan it on every watchdog tick
+type deadlockCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedDeadlocks // Key: project + window
+	zones   map[string]cachedZone      // Key: ProjectPath
+}
+
+type cachedDeadlocks struct {
+	deadlocks []laravel.DeadlockEntry
+	loaded    time.Time
+}
+
+type cachedZone struct {
+	loc     *time.Location
+	expires time.Time
+}
+
+func newDeadlockCache() *deadlockCache {
+	return &deadlockCache{
+		entries: make(map[string]cachedDeadlocks),
+		zones:   make(map[string]cachedZone),
+	}
+}
+
+// Get returns the project's deadlocks logged within window, as of the last scan
+func (c *deadlockCache) Get(projectPath string, window time.Duration) []laravel.DeadlockEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := projectPath + "\x00" + window.String()
+	if cached, ok := c.entries[key]; ok && time.Since(cached.loaded) < deadlockCacheTTL {
+		return cached.deadlocks
+	}
+
+	deadlocks, _ := laravel.GetDeadlocksSince(projectPath, time.Now().Add(-window), c.zone(projectPath))
+	c.entries[key] = cachedDeadlocks{deadlocks: deadlocks, loaded: time.Now()}
+	return deadlocks
+}
+
+// zone returns the project's app.timezone, the agent's own zone when it can't
+// be read. Caller holds the lock.
+func (c *deadlockCache) zone(projectPath string) *time.Location {
+	if cached, ok := c.zones[projectPath]; ok && time.Now().Before(cached.expires) {
+		return cached.loc
+	}
+
+	loc, err := laravel.GetAppTimezone(projectPath)
+	expires := time.Now().Add(timezoneCacheTTL)
+	if err != nil {
+		fmt.Printf("[Watchdog] Failed to read app timezone of %s, using local time: %v\n", projectPath, err)
+		loc = time.Local
+		expires = time.Now().Add(timezoneRetryTTL)
+	}
+	c.zones[projectPath] = cachedZone{loc: loc, expires: expires}
+	return loc
+}
+
+// projects the rule covers: its own, or every project with ingested data
+func (v *ruleValues) projects(rule config.Rule) []string {
+	if rule.Project != "" {
+		return []string{rule.Project}
+	}
+	return v.s.Store.Projects()
+}
+
+func ruleWindow(rule config.Rule) time.Duration {
+	if rule.WindowSeconds <= 0 {
+		return defaultRuleWindow
+	}
+	return time.Duration(rule.WindowSeconds) * time.Second
+}
+
+// Busiest PHP processes attached to an incident
+const maxCorrelatedProcesses = 10
+
+// correlate attaches the entries ingested during a breach window, and the
+// busiest PHP processes right now, to a new incident
+func (s *Server) correlate(rule config.Rule, from, to time.Time) *telemetry.Correlation {
+	projects := []string{rule.Project}
+	if rule.Project == "" {
+		projects = s.Store.Projects()
+	}
+
+	var entries []laravel.PerformanceEntry
+	for _, projectPath := range projects {
+		found, err := s.Store.Query(projectPath, from, to)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, found...)
+	}
+
+	c := telemetry.Correlate(entries, func(projectPath, method, uri string) string {
+		return s.routes.Matcher(projectPath).Normalize(method, uri)
+	}, from, to)
+
+	procs := s.Monitor.GetProcesses()
+	sort.SliceStable(procs, func(i, j int) bool { return procs[i].CpuPercent > procs[j].CpuPercent })
+	if len(procs) > maxCorrelatedProcesses {
+		procs = procs[:maxCorrelatedProcesses]
+	}
+	discovered := s.projects.Projects()
+	for i := range procs {
+		procs[i].Project = projectFor(discovered, procs[i])
+	}
+	c.Processes = append(c.Processes, procs...)
+
+	return &c
+}
@@ -1,11 +1,18 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/mike/sentinel-agent/pkg/config"
+	"github.com/mike/sentinel-agent/pkg/fpm"
+	"github.com/mike/sentinel-agent/pkg/nginx"
+	"github.com/mike/sentinel-agent/pkg/notify"
+	"github.com/mike/sentinel-agent/pkg/otlp"
 	"github.com/mike/sentinel-agent/pkg/runner"
 	"github.com/mike/sentinel-agent/pkg/telemetry"
 	"github.com/mike/sentinel-agent/pkg/watchdog"
@@ -15,18 +22,93 @@ type Server struct {
 	Config   *config.Config
 	Runner   *runner.Manager
 	Store    *telemetry.Store
+	Traces   *telemetry.TraceStore
 	Watchdog *watchdog.Watchdog
 	Monitor  *telemetry.Monitor
+	History  *telemetry.History // Watchdog loop samples for /telemetry/history
+	OTLP     *otlp.Exporter     // nil unless an OTLP endpoint is configured
+	Notify   *notify.Dispatcher // Sends incidents to the notification sinks
+
+	routes     *routeCache
+	projects   *projectCache // Discovered projects, for ingest and process mapping
+	ingest     *ingestLimiter
+	histograms *telemetry.RouteHistograms // Duration histograms for /metrics
+	deadlocks  *deadlockCache             // Recent lock errors, for deadlock_count rules
+	logFormat  *nginx.Format              // Parses NginxLogPath for incident suspects
 }
 
 func NewServer(cfg *config.Config) *Server {
-	return &Server{
-		Config:   cfg,
-		Runner:   runner.NewManager(),
-		Store:    telemetry.NewStore(100),
-		Watchdog: watchdog.New(),
-		Monitor:  telemetry.NewMonitor(),
+	s := &Server{
+		Config:     cfg,
+		Runner:     runner.NewManager(cfg),
+		Store:      openStore(cfg),
+		Traces:     openTraceStore(cfg),
+		Watchdog:   openWatchdog(),
+		Notify:     notify.New(cfg.NotificationSinks),
+		Monitor:    telemetry.NewMonitor(fpm.NewClient(cfg.PhpFpmAddress, cfg.PhpFpmStatusPath)),
+		History:    telemetry.NewHistory(),
+		routes:     newRouteCache(),
+		projects:   newProjectCache(cfg.WorkspaceRoot),
+		ingest:     newIngestLimiter(cfg.IngestRateLimit),
+		histograms: telemetry.NewRouteHistograms(),
+		deadlocks:  newDeadlockCache(),
 	}
+
+	format, err := nginx.ParseFormat(cfg.NginxLogFormat)
+	if err != nil {
+		fmt.Printf("[Watchdog] Invalid nginx log format, using combined: %v\n", err)
+		format, _ = nginx.ParseFormat("")
+	}
+	s.logFormat = format
+
+	if cfg.OTLP.Endpoint != "" {
+		s.OTLP = otlp.New(cfg.OTLP, func(projectPath, method, uri string) string {
+			return s.routes.Matcher(projectPath).Normalize(method, uri)
+		})
+	}
+	return s
+}
+
+// openStore persists metrics under ~/.sentinel/metrics, falling back to memory only
+func openStore(cfg *config.Config) *telemetry.Store {
+	home, _ := os.UserHomeDir()
+	dir := filepath.Join(home, ".sentinel", "metrics")
+
+	store, err := telemetry.OpenStore(dir, 1000, telemetry.Retention{
+		MaxAge:   time.Duration(cfg.MetricsRetentionHours) * time.Hour,
+		MaxBytes: int64(cfg.MetricsMaxSizeMB) * 1024 * 1024,
+	})
+	if err != nil {
+		fmt.Printf("[Store] Persistent metrics unavailable, using memory: %v\n", err)
+		return telemetry.NewStore(100)
+	}
+	return store
+}
+
+// openTraceStore persists traces under ~/.sentinel/traces, falling back to memory only
+func openTraceStore(cfg *config.Config) *telemetry.TraceStore {
+	home, _ := os.UserHomeDir()
+	dir := filepath.Join(home, ".sentinel", "traces")
+
+	traces, err := telemetry.OpenTraceStore(dir, 200, time.Duration(cfg.MetricsRetentionHours)*time.Hour)
+	if err != nil {
+		fmt.Printf("[Traces] Persistent traces unavailable, using memory: %v\n", err)
+		return telemetry.NewTraceStore(100)
+	}
+	return traces
+}
+
+// openWatchdog persists the incident log at ~/.sentinel/incidents.json, falling back to memory only
+func openWatchdog() *watchdog.Watchdog {
+	home, _ := os.UserHomeDir()
+	path := filepath.Join(home, ".sentinel", "incidents.json")
+
+	w, err := watchdog.Open(path)
+	if err != nil {
+		fmt.Printf("[Watchdog] Persistent incidents unavailable, using memory: %v\n", err)
+		return watchdog.New()
+	}
+	return w
 }
 
 func (s *Server) Start() error {
@@ -37,8 +119,17 @@ func (s *Server) Start() error {
 	mux.HandleFunc("/projects", s.handleProjects)
 	mux.HandleFunc("/projects/routes", s.handleRoutes)
 	mux.HandleFunc("/projects/logs", s.handleLogs)
+	mux.HandleFunc("/projects/logs/stream", s.handleLogStream)
+	mux.HandleFunc("/projects/logs/channels", s.handleLogChannels)
 	mux.HandleFunc("/projects/performance", s.handlePerformance)
 	mux.HandleFunc("/projects/performance/clear", s.handlePerformanceClear)
+	mux.HandleFunc("/projects/performance/summary", s.handlePerformanceSummary)
+	mux.HandleFunc("/projects/performance/errors", s.handlePerformanceErrors)
+	mux.HandleFunc("/projects/performance/nplusone", s.handleNPlusOne)
+	mux.HandleFunc("/projects/jobs", s.handleJobs)
+	mux.HandleFunc("/projects/jobs/summary", s.handleJobsSummary)
+	mux.HandleFunc("/projects/traces", s.handleTraces)
+	mux.HandleFunc("/projects/traces/", s.handleTrace)
 	mux.HandleFunc("/projects/deadlocks", s.handleDeadlocks) // New endpoint
 	mux.HandleFunc("/projects/ingest", s.handleIngest)       // Direct Telemetry Ingest
 
@@ -48,13 +139,29 @@ func (s *Server) Start() error {
 	mux.HandleFunc("/runner/status", s.handleRunnerStatus)
 
 	mux.HandleFunc("/telemetry", s.handleTelemetry)
+	mux.HandleFunc("/telemetry/history", s.handleTelemetryHistory)
+	mux.HandleFunc("/telemetry/processes", s.handleTelemetryProcesses)
+	mux.HandleFunc("/telemetry/fpm", s.handleTelemetryFpm)
+	mux.HandleFunc("/metrics", s.handleMetrics) // Prometheus
 	mux.HandleFunc("/config", s.handleConfig)
 	mux.HandleFunc("/restart", s.handleRestart)
 	mux.HandleFunc("/proxy", s.handleProxy)
 	mux.HandleFunc("/alerts", s.handleAlerts)
+	mux.HandleFunc("/alerts/history", s.handleAlertHistory)
+	mux.HandleFunc("/alerts/sinks", s.handleAlertSinks)
+	mux.HandleFunc("/alerts/sinks/test", s.handleAlertSinksTest)
+	mux.HandleFunc("/alerts/", s.handleAlertAck) // /alerts/{id}/ack
 
 	// Start Watchdog Routine
 	go s.startWatchdogLoop()
+	go s.startCompactionLoop()
+	go s.startHistogramLoop()
+	go s.Notify.Run(context.Background())
+	s.startTransports(context.Background())
+	if s.OTLP != nil {
+		fmt.Printf("[OTLP] Exporting to %s\n", s.Config.OTLP.Endpoint)
+		go s.OTLP.Run(context.Background())
+	}
 
 	// Add CORS middleware
 	handler := enableCORS(mux)
@@ -86,14 +193,33 @@ func (s *Server) startWatchdogLoop() {
 	ticker := time.NewTicker(5 * time.Second)
 	for range ticker.C {
 		stats := s.Monitor.GetSystemStats()
+		s.History.Record(time.Now(), stats)
 
 		// Run Check
 		if s.Watchdog != nil {
-			s.Watchdog.Check(
-				stats.PhpFpmCpuPercent,
-				s.Config.CpuThreshold,
-				s.Config.NginxLogPath,
-			)
+			values := s.ruleValues(stats)
+			for _, incident := range s.Watchdog.Check(s.Config.WatchdogRules(), watchdog.Sources{
+				Value:     values.Value,
+				AccessLog: watchdog.AccessLog{Path: s.Config.NginxLogPath, Format: s.logFormat},
+				Correlate: s.correlate,
+				Running:   values.Running,
+			}) {
+				fmt.Printf("[Watchdog] %s %s (%s): %s\n", incident.Rule, incident.State, incident.Severity, incident.Message)
+				s.Notify.Notify(incident)
+			}
+		}
+	}
+}
+
+func (s *Server) startCompactionLoop() {
+	// Retention doesn't need to be precise, compact every 10 minutes
+	ticker := time.NewTicker(10 * time.Minute)
+	for range ticker.C {
+		if err := s.Store.Compact(); err != nil {
+			fmt.Printf("[Store] Compaction failed: %v\n", err)
+		}
+		if err := s.Traces.Compact(); err != nil {
+			fmt.Printf("[Traces] Compaction failed: %v\n", err)
 		}
 	}
 }
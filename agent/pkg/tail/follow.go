@@ -0,0 +1,119 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// Follow behaves like `tail -F`: it polls the file returned by resolve and calls
+// onLines with every complete line appended since the last poll (an empty batch
+// on idle polls). Following starts at the current end of the file.
+//
+// The file is reopened from the start when resolve returns a different path
+// (e.g. daily rotation), when the file is replaced, or when it is truncated.
+func Follow(ctx context.Context, resolve func() string, interval time.Duration, onLines func([]string)) {
+	var file *os.File
+	var path string
+	var offset int64
+	var partial []byte
+
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	open := func(p string, fromEnd bool) {
+		if file != nil {
+			file.Close()
+			file = nil
+		}
+		path = p
+		offset = 0
+		partial = nil
+
+		f, err := os.Open(p)
+		if err != nil {
+			return
+		}
+		file = f
+		if fromEnd {
+			if stat, err := f.Stat(); err == nil {
+				offset = stat.Size()
+			}
+		}
+	}
+
+	open(resolve(), true)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// 1. Rotation: a new file name, or the same name pointing at a new file
+		current := resolve()
+		if current != path || file == nil {
+			open(current, false)
+		} else if onDisk, err := os.Stat(path); err == nil {
+			if stat, err := file.Stat(); err == nil && !os.SameFile(stat, onDisk) {
+				open(path, false)
+			}
+		}
+
+		if file == nil {
+			onLines(nil)
+			continue
+		}
+
+		// 2. Truncation: start again from the top
+		stat, err := file.Stat()
+		if err != nil {
+			onLines(nil)
+			continue
+		}
+		if stat.Size() < offset {
+			offset = 0
+			partial = nil
+		}
+
+		// 3. Read what was appended
+		var lines []string
+		if stat.Size() > offset {
+			// Large bursts are consumed over several polls
+			readSize := stat.Size() - offset
+			if readSize > maxScanBytes {
+				readSize = maxScanBytes
+			}
+			buf := make([]byte, readSize)
+			n, err := file.ReadAt(buf, offset)
+			if err != nil && err != io.EOF {
+				onLines(nil)
+				continue
+			}
+			offset += int64(n)
+
+			data := append(partial, buf[:n]...)
+			// Keep an unterminated last line until the writer finishes it
+			idx := bytes.LastIndexByte(data, '\n')
+			if idx == -1 {
+				partial = data
+			} else {
+				for _, line := range bytes.Split(data[:idx], []byte("\n")) {
+					lines = append(lines, string(bytes.TrimSuffix(line, []byte("\r"))))
+				}
+				partial = append([]byte(nil), data[idx+1:]...)
+			}
+		}
+
+		onLines(lines)
+	}
+}
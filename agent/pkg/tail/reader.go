@@ -0,0 +1,133 @@
+package tail
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+const (
+	chunkSize = 64 * 1024
+
+	// Hard ceiling on how far back we scan, so a file with no recognisable
+	// entry headers can't pull a multi-GB log into memory.
+	maxScanBytes = 64 * 1024 * 1024
+)
+
+// LastLines returns the last n lines of the file at path
+func LastLines(path string, n int) ([]string, error) {
+	return LastEntries(path, n, nil)
+}
+
+// LastEntries returns the lines making up the last n logical entries of the file.
+// isStart reports whether a line begins a new entry (e.g. a Monolog header);
+// continuation lines are kept with the entry they follow.
+// A nil isStart treats every line as its own entry.
+func LastEntries(path string, n int, isStart func(string) bool) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return readBackward(file, stat.Size(), n, isStart)
+}
+
+// Backward calls fn with the lines of the file at path, newest first, until
+// fn returns false or the scan limit is reached
+func Backward(path string, fn func(line string) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	return scanBackward(file, stat.Size(), fn)
+}
+
+func readBackward(r io.ReaderAt, size int64, n int, isStart func(string) bool) ([]string, error) {
+	if n <= 0 || size == 0 {
+		return []string{}, nil
+	}
+
+	var reversed []string // collected newest first
+	found := 0
+	err := scanBackward(r, size, func(line string) bool {
+		reversed = append(reversed, line)
+		if isStart == nil || isStart(line) {
+			found++
+		}
+		return found < n
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reverse(reversed), nil
+}
+
+func scanBackward(r io.ReaderAt, size int64, fn func(line string) bool) error {
+	var carry []byte // partial line left over from the previous chunk
+	pos := size
+	scanned := int64(0)
+	atEOF := true
+
+	for pos > 0 && scanned < maxScanBytes {
+		readSize := int64(chunkSize)
+		if pos < readSize {
+			readSize = pos
+		}
+		pos -= readSize
+		scanned += readSize
+
+		buf := make([]byte, readSize, int(readSize)+len(carry))
+		if _, err := r.ReadAt(buf, pos); err != nil && err != io.EOF {
+			return err
+		}
+		buf = append(buf, carry...)
+
+		// Drop the final newline so it doesn't produce an empty last line
+		if atEOF {
+			buf = bytes.TrimSuffix(buf, []byte("\n"))
+			atEOF = false
+		}
+
+		// Everything after the last newline is a complete line; the head of
+		// the buffer may be cut mid-line and is carried to the next chunk.
+		for {
+			idx := bytes.LastIndexByte(buf, '\n')
+			if idx == -1 {
+				break
+			}
+			line := string(bytes.TrimSuffix(buf[idx+1:], []byte("\r")))
+			buf = buf[:idx]
+
+			if !fn(line) {
+				return nil
+			}
+		}
+		carry = append([]byte(nil), buf...)
+	}
+
+	// Reached the start of the file: the carry is the first line
+	if pos == 0 && len(carry) > 0 {
+		fn(string(bytes.TrimSuffix(carry, []byte("\r"))))
+	}
+	return nil
+}
+
+func reverse(lines []string) []string {
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
@@ -0,0 +1,221 @@
+package tail
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile creates a file whose content starts at offset; the bytes before it
+// are a sparse hole, so multi-GB files cost no disk space
+func writeFile(t *testing.T, offset int64, write func(w *bufio.Writer)) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.log")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if offset > 0 {
+		if err := file.Truncate(offset); err != nil {
+			t.Skipf("sparse files unsupported: %v", err)
+		}
+		if _, err := file.Seek(offset, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := bufio.NewWriter(file)
+	write(w)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func numbered(i int) string {
+	return fmt.Sprintf("line %07d", i)
+}
+
+func TestLastLinesMultiGBFile(t *testing.T) {
+	const total = 100000 // ~1.2MB of lines, so reads cross many chunks
+	path := writeFile(t, 3<<30, func(w *bufio.Writer) {
+		w.WriteString("\n") // Ends the hole's (NUL) line
+		for i := 0; i < total; i++ {
+			w.WriteString(numbered(i) + "\n")
+		}
+	})
+
+	for _, n := range []int{1, 10, 5000, 50000, total} {
+		lines, err := LastLines(path, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lines) != n {
+			t.Fatalf("n=%d: got %d lines", n, len(lines))
+		}
+		for i, line := range lines {
+			if want := numbered(total - n + i); line != want {
+				t.Fatalf("n=%d: line %d is %q, want %q", n, i, line, want)
+			}
+		}
+	}
+}
+
+func TestLastLinesChunkBoundaries(t *testing.T) {
+	// Line lengths that don't divide the chunk size, so lines straddle every boundary
+	for _, width := range []int{1, 7, 100, chunkSize - 1, chunkSize, chunkSize + 1} {
+		const total = 300
+		line := func(i int) string {
+			s := fmt.Sprintf("%d:", i)
+			return s + strings.Repeat("x", max(width-len(s), 0))
+		}
+		path := writeFile(t, 0, func(w *bufio.Writer) {
+			for i := 0; i < total; i++ {
+				w.WriteString(line(i) + "\n")
+			}
+		})
+
+		for _, n := range []int{1, 2, 150, total, total + 10} {
+			lines, err := LastLines(path, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := min(n, total)
+			if len(lines) != want {
+				t.Fatalf("width=%d n=%d: got %d lines, want %d", width, n, len(lines), want)
+			}
+			for i, got := range lines {
+				if expected := line(total - want + i); got != expected {
+					t.Fatalf("width=%d n=%d: line %d is %.20q..., want %.20q...", width, n, i, got, expected)
+				}
+			}
+		}
+	}
+}
+
+func TestLastLinesLongerThanChunk(t *testing.T) {
+	long := strings.Repeat("a", 3*chunkSize+17)
+	path := writeFile(t, 0, func(w *bufio.Writer) {
+		w.WriteString(long + "\r\n") // First line of the file, so it comes from the carry
+		w.WriteString("short\r\n")
+		w.WriteString(long + "b\n")
+		w.WriteString("last") // No trailing newline
+	})
+
+	lines, err := LastLines(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{long, "short", long + "b", "last"}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(want))
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Fatalf("line %d: got %d bytes, want %d", i, len(lines[i]), len(want[i]))
+		}
+	}
+}
+
+func TestLastEntriesKeepsContinuationLines(t *testing.T) {
+	// Multi-line entries, each with a stack trace longer than a chunk
+	const total = 20
+	trace := strings.Repeat("#0 /app/vendor/laravel/framework/src/Foo.php(12): bar()\n", chunkSize/50)
+	path := writeFile(t, 1<<30, func(w *bufio.Writer) {
+		w.WriteString("\n")
+		for i := 0; i < total; i++ {
+			fmt.Fprintf(w, "[2024-01-01 00:00:%02d] local.ERROR: entry %d\n%s", i, i, trace)
+		}
+	})
+
+	isStart := func(line string) bool { return strings.HasPrefix(line, "[") }
+	traceLines := strings.Count(trace, "\n")
+
+	for _, n := range []int{1, 3, total} {
+		lines, err := LastEntries(path, n, isStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lines) != n*(1+traceLines) {
+			t.Fatalf("n=%d: got %d lines, want %d", n, len(lines), n*(1+traceLines))
+		}
+		if want := fmt.Sprintf("local.ERROR: entry %d", total-n); !strings.HasSuffix(lines[0], want) {
+			t.Fatalf("n=%d: first line is %q, want an entry %d header", n, lines[0], total-n)
+		}
+	}
+}
+
+func TestBackwardStopsWhenAsked(t *testing.T) {
+	path := writeFile(t, 2<<30, func(w *bufio.Writer) {
+		w.WriteString("\n")
+		for i := 0; i < 10000; i++ {
+			w.WriteString(numbered(i) + "\n")
+		}
+	})
+
+	var seen []string
+	err := Backward(path, func(line string) bool {
+		seen = append(seen, line)
+		return len(seen) < 3
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{numbered(9999), numbered(9998), numbered(9997)}
+	if strings.Join(seen, ",") != strings.Join(want, ",") {
+		t.Fatalf("got %v, want %v", seen, want)
+	}
+}
+
+func TestBackwardScanCeiling(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes more than maxScanBytes")
+	}
+
+	const width = 64 // Including the newline
+	total := maxScanBytes/width + 100000
+	path := writeFile(t, 0, func(w *bufio.Writer) {
+		for i := 0; i < total; i++ {
+			s := numbered(i)
+			w.WriteString(s + strings.Repeat(".", width-len(s)-1) + "\n")
+		}
+	})
+
+	count := 0
+	err := Backward(path, func(line string) bool {
+		if len(line) != width-1 || !strings.HasPrefix(line, "line ") {
+			t.Fatalf("got a cut line %q", line)
+		}
+		count++
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The oldest line in range is dropped: without the newline before it, it may be cut
+	if want := maxScanBytes/width - 1; count != want {
+		t.Fatalf("read %d lines, want the %d within the scan limit", count, want)
+	}
+}
+
+func TestLastLinesEmpty(t *testing.T) {
+	path := writeFile(t, 0, func(w *bufio.Writer) {})
+
+	lines, err := LastLines(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 0 {
+		t.Fatalf("got %v from an empty file", lines)
+	}
+
+	if _, err := LastLines(filepath.Join(t.TempDir(), "missing.log"), 10); !os.IsNotExist(err) {
+		t.Fatalf("got %v for a missing file, want a not-exist error", err)
+	}
+}
@@ -0,0 +1,150 @@
+package telemetry
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/laravel"
+)
+
+// Entries, routes and queries listed per correlation
+const maxCorrelated = 10
+
+// Correlation is what ingested entries say about a time window,
+// e.g. which routes were running while an incident built up
+type Correlation struct {
+	From        time.Time         `json:"from"`
+	To          time.Time         `json:"to"`
+	Entries     int               `json:"entries"`
+	Routes      []RouteLoad       `json:"routes"`       // Most total time first
+	Slowest     []CorrelatedEntry `json:"slowest"`      // Slowest requests, jobs and commands
+	SlowQueries []CorrelatedQuery `json:"slow_queries"` // Slowest first
+	Processes   []PHPProcess      `json:"processes"`    // Busiest PHP processes when the incident opened
+}
+
+// RouteLoad is the time one route (or job, or command) spent in the window
+type RouteLoad struct {
+	Project string  `json:"project"`
+	Kind    string  `json:"kind"`
+	Method  string  `json:"method,omitempty"`
+	Route   string  `json:"route"` // Route pattern, job class or command name
+	Count   int     `json:"count"`
+	TotalMS float64 `json:"total_ms"`
+	P95MS   float64 `json:"p95_ms"`
+	Errors  int     `json:"errors"`
+}
+
+// CorrelatedEntry is an ingested entry without its query details
+type CorrelatedEntry struct {
+	Project    string  `json:"project"`
+	Kind       string  `json:"kind"`
+	Method     string  `json:"method,omitempty"`
+	URI        string  `json:"uri,omitempty"`
+	Name       string  `json:"name,omitempty"`
+	Status     int     `json:"status,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+	MemoryMB   float64 `json:"memory_mb"`
+	QueryCount int     `json:"query_count"`
+	Timestamp  string  `json:"timestamp"`
+	TraceID    string  `json:"trace_id,omitempty"`
+}
+
+// CorrelatedQuery is a slow query and the route that ran it
+type CorrelatedQuery struct {
+	Project    string  `json:"project"`
+	Route      string  `json:"route"`
+	SQL        string  `json:"sql"`
+	DurationMS float64 `json:"duration_ms"`
+	Timestamp  string  `json:"timestamp"`
+}
+
+// Correlate summarizes the entries of a window. normalize maps a URI to its route pattern.
+func Correlate(entries []laravel.PerformanceEntry, normalize func(projectPath, method, uri string) string, from, to time.Time) Correlation {
+	c := Correlation{
+		From:        from,
+		To:          to,
+		Entries:     len(entries),
+		Routes:      []RouteLoad{},
+		Slowest:     []CorrelatedEntry{},
+		SlowQueries: []CorrelatedQuery{},
+		Processes:   []PHPProcess{},
+	}
+
+	type group struct {
+		load      RouteLoad
+		durations []float64
+	}
+	groups := make(map[string]*group)
+
+	for _, e := range entries {
+		// 1. Time per route
+		load := RouteLoad{Project: e.Project, Kind: e.EntryKind(), Route: e.Name}
+		if load.Kind == laravel.KindRequest {
+			load.Method = e.Method
+			load.Route = normalize(e.Project, e.Method, e.URI)
+		}
+		key := load.Project + "\x00" + load.Kind + "\x00" + load.Method + "\x00" + load.Route
+
+		g, ok := groups[key]
+		if !ok {
+			g = &group{load: load}
+			groups[key] = g
+		}
+		g.load.Count++
+		g.load.TotalMS += e.DurationMS
+		g.durations = append(g.durations, e.DurationMS)
+		if IsError(e) {
+			g.load.Errors++
+		}
+
+		// 2. Slow queries, attributed to the route
+		for _, q := range e.SlowQueries {
+			c.SlowQueries = append(c.SlowQueries, CorrelatedQuery{
+				Project:    e.Project,
+				Route:      load.Route,
+				SQL:        q.SQL,
+				DurationMS: q.DurationMS,
+				Timestamp:  e.Timestamp,
+			})
+		}
+	}
+
+	for _, g := range groups {
+		sort.Float64s(g.durations)
+		g.load.P95MS = Percentile(g.durations, 95)
+		c.Routes = append(c.Routes, g.load)
+	}
+	sort.Slice(c.Routes, func(i, j int) bool { return c.Routes[i].TotalMS > c.Routes[j].TotalMS })
+	if len(c.Routes) > maxCorrelated {
+		c.Routes = c.Routes[:maxCorrelated]
+	}
+
+	sort.SliceStable(c.SlowQueries, func(i, j int) bool { return c.SlowQueries[i].DurationMS > c.SlowQueries[j].DurationMS })
+	if len(c.SlowQueries) > maxCorrelated {
+		c.SlowQueries = c.SlowQueries[:maxCorrelated]
+	}
+
+	// 3. Slowest entries
+	slowest := append([]laravel.PerformanceEntry(nil), entries...)
+	sort.SliceStable(slowest, func(i, j int) bool { return slowest[i].DurationMS > slowest[j].DurationMS })
+	if len(slowest) > maxCorrelated {
+		slowest = slowest[:maxCorrelated]
+	}
+	for _, e := range slowest {
+		c.Slowest = append(c.Slowest, CorrelatedEntry{
+			Project:    e.Project,
+			Kind:       e.EntryKind(),
+			Method:     e.Method,
+			URI:        e.URI,
+			Name:       e.Name,
+			Status:     e.Status,
+			DurationMS: e.DurationMS,
+			MemoryMB:   e.MemoryMB,
+			QueryCount: e.QueryCount,
+			Timestamp:  e.Timestamp,
+			TraceID:    e.TraceID,
+		})
+	}
+
+	return c
+}
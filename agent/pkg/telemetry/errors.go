@@ -0,0 +1,139 @@
+package telemetry
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/laravel"
+)
+
+// RouteErrors counts the failed responses of one method + route
+type RouteErrors struct {
+	Method        string  `json:"method"`
+	Route         string  `json:"route"`
+	RouteName     string  `json:"route_name,omitempty"`
+	Requests      int     `json:"requests"`
+	ClientErrors  int     `json:"client_errors"` // 4xx
+	ServerErrors  int     `json:"server_errors"` // 5xx
+	Exceptions    int     `json:"exceptions"`
+	ErrorRate     float64 `json:"error_rate"` // Share of 5xx responses or exceptions
+	LastException string  `json:"last_exception,omitempty"`
+	LastSeen      string  `json:"last_seen,omitempty"` // Last error
+}
+
+// ErrorBucket is the error rate over one slice of the timeline
+type ErrorBucket struct {
+	Start     string  `json:"start"`
+	Requests  int     `json:"requests"`
+	Errors    int     `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// ErrorReport is the error-rate view of a set of request entries
+type ErrorReport struct {
+	Requests  int           `json:"requests"`
+	Errors    int           `json:"errors"`
+	ErrorRate float64       `json:"error_rate"`
+	Routes    []RouteErrors `json:"routes"`   // Routes with at least one 4xx, 5xx or exception, worst first
+	Timeline  []ErrorBucket `json:"timeline"` // Oldest first
+}
+
+// IsError reports whether an entry counts against the error rate
+func IsError(e laravel.PerformanceEntry) bool {
+	return e.Status >= 500 || e.Exception != "" || e.Failed
+}
+
+// SummarizeErrors builds the error report, bucketing the timeline by bucket
+func SummarizeErrors(entries []laravel.PerformanceEntry, normalize func(method, uri string) string, bucket time.Duration) ErrorReport {
+	report := ErrorReport{Routes: []RouteErrors{}, Timeline: []ErrorBucket{}}
+
+	routes := make(map[string]*RouteErrors)
+	routeErrors := make(map[string]int)
+	buckets := make(map[int64]*ErrorBucket)
+
+	for _, e := range entries {
+		failed := IsError(e)
+		report.Requests++
+		if failed {
+			report.Errors++
+		}
+
+		// 1. Per route
+		route := normalize(e.Method, e.URI)
+		key := e.Method + " " + route
+		r, ok := routes[key]
+		if !ok {
+			r = &RouteErrors{Method: e.Method, Route: route}
+			routes[key] = r
+		}
+		r.Requests++
+		if failed {
+			routeErrors[key]++
+		}
+		if e.RouteName != "" {
+			r.RouteName = e.RouteName
+		}
+		switch {
+		case e.Status >= 500:
+			r.ServerErrors++
+		case e.Status >= 400:
+			r.ClientErrors++
+		}
+		if e.Exception != "" {
+			r.Exceptions++
+			if e.Timestamp >= r.LastSeen {
+				r.LastException = e.Exception
+			}
+		}
+		if (failed || e.Status >= 400) && e.Timestamp > r.LastSeen {
+			r.LastSeen = e.Timestamp
+		}
+
+		// 2. Timeline
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", e.Timestamp, time.Local)
+		if err != nil || bucket <= 0 {
+			continue
+		}
+		start := t.Truncate(bucket).Unix()
+		b, ok := buckets[start]
+		if !ok {
+			b = &ErrorBucket{Start: t.Truncate(bucket).Format("2006-01-02 15:04:05")}
+			buckets[start] = b
+		}
+		b.Requests++
+		if failed {
+			b.Errors++
+		}
+	}
+
+	if report.Requests > 0 {
+		report.ErrorRate = float64(report.Errors) / float64(report.Requests)
+	}
+
+	for key, r := range routes {
+		if r.ClientErrors+r.ServerErrors+r.Exceptions == 0 {
+			continue
+		}
+		r.ErrorRate = float64(routeErrors[key]) / float64(r.Requests)
+		report.Routes = append(report.Routes, *r)
+	}
+	sort.Slice(report.Routes, func(i, j int) bool {
+		if report.Routes[i].ErrorRate != report.Routes[j].ErrorRate {
+			return report.Routes[i].ErrorRate > report.Routes[j].ErrorRate
+		}
+		return report.Routes[i].Requests > report.Routes[j].Requests
+	})
+
+	starts := make([]int64, 0, len(buckets))
+	for start := range buckets {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	for _, start := range starts {
+		b := buckets[start]
+		b.ErrorRate = float64(b.Errors) / float64(b.Requests)
+		report.Timeline = append(report.Timeline, *b)
+	}
+
+	return report
+}
@@ -0,0 +1,175 @@
+package telemetry
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/mike/sentinel-agent/pkg/laravel"
+)
+
+// DurationBuckets are the upper bounds (seconds) of the duration histograms,
+// the boundaries OpenTelemetry recommends for http.server.request.duration
+var DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+// Observations waiting to be folded; beyond this they are dropped
+const maxPendingObservations = 50000
+
+// Every label set is a /metrics series kept for the agent's lifetime, so new
+// label sets beyond maxHistogramSeries are counted under OtherRoute instead
+const maxHistogramSeries = 2000
+
+// Route labels that stand for many URIs
+const (
+	UnmatchedRoute = "unmatched" // Requests matching none of a project's routes
+	OtherRoute     = "other"     // Anything past maxHistogramSeries
+)
+
+// DurationHistogram is a cumulative histogram of one label set
+type DurationHistogram struct {
+	Project string
+	Kind    string // laravel.KindRequest, KindJob or KindCommand
+	Method  string // Requests only
+	Route   string // Route pattern, job class or command name
+	Status  string // Status class ("2xx") for requests, "failed"/"ok" for jobs and commands
+
+	Buckets []uint64 // Cumulative counts per DurationBuckets bound
+	Count   uint64
+	Sum     float64 // Seconds
+}
+
+// RouteHistograms accumulates duration histograms from ingested entries.
+// Observe only queues the entry; route normalization (which may shell out to
+// artisan) happens in Fold, off the ingest path.
+type RouteHistograms struct {
+	mu         sync.Mutex
+	pending    []laravel.PerformanceEntry
+	dropped    uint64
+	overflowed uint64
+	histograms map[string]*DurationHistogram
+}
+
+func NewRouteHistograms() *RouteHistograms {
+	return &RouteHistograms{histograms: make(map[string]*DurationHistogram)}
+}
+
+func (h *RouteHistograms) Observe(entry laravel.PerformanceEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.pending) >= maxPendingObservations {
+		h.dropped++
+		return
+	}
+	h.pending = append(h.pending, entry)
+}
+
+// Fold adds the queued entries to the histograms. normalize maps a URI to its route pattern.
+func (h *RouteHistograms) Fold(normalize func(projectPath, method, uri string) string) {
+	h.mu.Lock()
+	pending := h.pending
+	h.pending = nil
+	h.mu.Unlock()
+
+	// Normalize without the lock so Observe never waits on artisan
+	type observation struct {
+		key  string
+		hist DurationHistogram
+		secs float64
+	}
+	observations := make([]observation, 0, len(pending))
+	for _, e := range pending {
+		hist := DurationHistogram{Project: e.Project, Kind: e.EntryKind()}
+		if hist.Kind == laravel.KindRequest {
+			hist.Method = e.Method
+			hist.Route = normalize(e.Project, e.Method, e.URI)
+			hist.Status = statusClass(e.Status)
+		} else {
+			hist.Route = e.Name
+			hist.Status = "ok"
+			if e.Failed {
+				hist.Status = "failed"
+			}
+		}
+		observations = append(observations, observation{key: hist.key(), hist: hist, secs: e.DurationMS / 1000})
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, o := range observations {
+		hist, ok := h.histograms[o.key]
+		if !ok && len(h.histograms) >= maxHistogramSeries {
+			h.overflowed++
+			o.hist.Route = OtherRoute
+			o.key = o.hist.key()
+			hist, ok = h.histograms[o.key]
+		}
+		if !ok {
+			hist = &o.hist
+			hist.Buckets = make([]uint64, len(DurationBuckets))
+			h.histograms[o.key] = hist
+		}
+		hist.Count++
+		hist.Sum += o.secs
+		for i, bound := range DurationBuckets {
+			if o.secs <= bound {
+				hist.Buckets[i]++
+			}
+		}
+	}
+}
+
+// Snapshot returns a copy of every histogram, in a stable order
+func (h *RouteHistograms) Snapshot() []DurationHistogram {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	result := make([]DurationHistogram, 0, len(h.histograms))
+	for _, hist := range h.histograms {
+		c := *hist
+		c.Buckets = append([]uint64(nil), hist.Buckets...)
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Project != b.Project {
+			return a.Project < b.Project
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Route != b.Route {
+			return a.Route < b.Route
+		}
+		if a.Method != b.Method {
+			return a.Method < b.Method
+		}
+		return a.Status < b.Status
+	})
+	return result
+}
+
+// Dropped counts observations lost because Fold fell behind
+func (h *RouteHistograms) Dropped() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.dropped
+}
+
+// Overflowed counts observations counted under OtherRoute because of the series cap
+func (h *RouteHistograms) Overflowed() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.overflowed
+}
+
+func (hist *DurationHistogram) key() string {
+	return hist.Project + "\x00" + hist.Kind + "\x00" + hist.Method + "\x00" + hist.Route + "\x00" + hist.Status
+}
+
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return string(rune('0'+status/100)) + "xx"
+}
@@ -0,0 +1,149 @@
+package telemetry
+
+import (
+	"sync"
+	"time"
+)
+
+// History resolutions: raw samples for the last hour, minute averages for the last day
+const (
+	fineResolution   = 5 * time.Second
+	fineSpan         = time.Hour
+	coarseResolution = time.Minute
+	coarseSpan       = 24 * time.Hour
+)
+
+// StatsSample is one point of the system stats history.
+// Downsampled points average every field except CpuPercentMax.
+type StatsSample struct {
+	Timestamp     time.Time `json:"timestamp"`
+	CpuPercent    float64   `json:"php_fpm_cpu_percent"`
+	CpuPercentMax float64   `json:"php_fpm_cpu_percent_max"` // Peak within the point
+	Workers       float64   `json:"php_fpm_worker_count"`
+	WebMemoryMB   float64   `json:"php_web_memory_mb"`
+	CliMemoryMB   float64   `json:"php_cli_memory_mb"`
+	AgentMemoryMB float64   `json:"memory_usage_mb"`
+	Goroutines    float64   `json:"num_goroutines"`
+}
+
+// History keeps the watchdog loop's samples in two fixed-size rings
+type History struct {
+	mu     sync.RWMutex
+	fine   *sampleRing
+	coarse *sampleRing
+
+	// Samples of the minute not yet rolled into the coarse ring
+	minute  time.Time
+	pending []StatsSample
+}
+
+func NewHistory() *History {
+	return &History{
+		fine:   newSampleRing(int(fineSpan / fineResolution)),
+		coarse: newSampleRing(int(coarseSpan / coarseResolution)),
+	}
+}
+
+// Record adds a sample taken at t
+func (h *History) Record(t time.Time, stats SystemStats) {
+	sample := StatsSample{
+		Timestamp:     t,
+		CpuPercent:    stats.PhpFpmCpuPercent,
+		CpuPercentMax: stats.PhpFpmCpuPercent,
+		Workers:       float64(stats.PhpFpmWorkerCount),
+		WebMemoryMB:   float64(stats.PhpWebMemoryMB),
+		CliMemoryMB:   float64(stats.PhpCliMemoryMB),
+		AgentMemoryMB: float64(stats.MemoryUsageMB),
+		Goroutines:    float64(stats.NumGoroutine),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.fine.push(sample)
+
+	minute := t.Truncate(coarseResolution)
+	if !minute.Equal(h.minute) && len(h.pending) > 0 {
+		h.coarse.push(average(h.minute, h.pending))
+		h.pending = h.pending[:0]
+	}
+	h.minute = minute
+	h.pending = append(h.pending, sample)
+}
+
+// Range returns the samples of the last d, oldest first, and their resolution.
+// Up to an hour that is every sample; beyond, minute averages (capped at a day).
+func (h *History) Range(d time.Duration) ([]StatsSample, time.Duration) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	cutoff := time.Now().Add(-d)
+
+	if d <= fineSpan {
+		return h.fine.since(cutoff), fineResolution
+	}
+
+	samples := h.coarse.since(cutoff)
+	if len(h.pending) > 0 {
+		// The current minute, so the newest data shows up without waiting for rollover
+		samples = append(samples, average(h.minute, h.pending))
+	}
+	return samples, coarseResolution
+}
+
+func average(at time.Time, samples []StatsSample) StatsSample {
+	avg := StatsSample{Timestamp: at}
+	for _, s := range samples {
+		avg.CpuPercent += s.CpuPercent
+		avg.Workers += s.Workers
+		avg.WebMemoryMB += s.WebMemoryMB
+		avg.CliMemoryMB += s.CliMemoryMB
+		avg.AgentMemoryMB += s.AgentMemoryMB
+		avg.Goroutines += s.Goroutines
+		if s.CpuPercentMax > avg.CpuPercentMax {
+			avg.CpuPercentMax = s.CpuPercentMax
+		}
+	}
+
+	n := float64(len(samples))
+	avg.CpuPercent /= n
+	avg.Workers /= n
+	avg.WebMemoryMB /= n
+	avg.CliMemoryMB /= n
+	avg.AgentMemoryMB /= n
+	avg.Goroutines /= n
+	return avg
+}
+
+// sampleRing is a fixed-capacity ring buffer; the oldest sample is overwritten when full
+type sampleRing struct {
+	buf   []StatsSample
+	start int // Index of the oldest sample
+	n     int
+}
+
+func newSampleRing(capacity int) *sampleRing {
+	return &sampleRing{buf: make([]StatsSample, capacity)}
+}
+
+func (r *sampleRing) push(s StatsSample) {
+	if r.n < len(r.buf) {
+		r.buf[(r.start+r.n)%len(r.buf)] = s
+		r.n++
+		return
+	}
+	r.buf[r.start] = s
+	r.start = (r.start + 1) % len(r.buf)
+}
+
+// since returns the samples taken at or after cutoff, oldest first
+func (r *sampleRing) since(cutoff time.Time) []StatsSample {
+	result := []StatsSample{}
+	for i := 0; i < r.n; i++ {
+		s := r.buf[(r.start+i)%len(r.buf)]
+		if !s.Timestamp.Before(cutoff) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
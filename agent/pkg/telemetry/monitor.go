@@ -1,12 +1,13 @@
 package telemetry
 
 import (
-	"net"
+	"errors"
 	"runtime"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/mike/sentinel-agent/pkg/fpm"
 	"github.com/shirou/gopsutil/v3/process"
 )
 
@@ -20,18 +21,22 @@ type SystemStats struct {
 }
 
 type Status struct {
-	PhpFpm      bool        `json:"php_fpm"`
-	SystemStats SystemStats `json:"system_stats"`
+	PhpFpm       bool        `json:"php_fpm"`
+	PhpFpmStatus *fpm.Status `json:"php_fpm_status,omitempty"` // nil unless the status page answered
+	PhpFpmError  string      `json:"php_fpm_error,omitempty"`
+	SystemStats  SystemStats `json:"system_stats"`
 }
 
 type Monitor struct {
 	procs map[int32]*process.Process
 	mu    sync.Mutex
+	fpm   *fpm.Client
 }
 
-func NewMonitor() *Monitor {
+func NewMonitor(fpmClient *fpm.Client) *Monitor {
 	return &Monitor{
 		procs: make(map[int32]*process.Process),
+		fpm:   fpmClient,
 	}
 }
 
@@ -51,22 +56,82 @@ func (m *Monitor) GetSystemStats() SystemStats {
 	}
 }
 
+// PHP process roles
+const (
+	RoleFpmMaster    = "fpm-master"
+	RoleFpmWorker    = "fpm-worker"
+	RoleCGI          = "cgi"
+	RoleArtisanServe = "artisan-serve"
+	RoleQueueWorker  = "queue-worker"
+	RoleHorizon      = "horizon"
+	RoleSchedule     = "schedule"
+	RoleArtisan      = "artisan" // Any other artisan command
+	RoleCLI          = "cli"     // Plain php scripts
+)
+
+// PHPProcess is one PHP process seen by the monitor
+type PHPProcess struct {
+	PID        int32   `json:"pid"`
+	PPID       int32   `json:"ppid"`
+	Role       string  `json:"role"`
+	Pool       string  `json:"pool,omitempty"` // FPM pool, from "php-fpm: pool www"
+	CpuPercent float64 `json:"cpu_percent"`
+	RssMB      float64 `json:"rss_mb"`
+	AgeSeconds int64   `json:"age_seconds"`
+	Cwd        string  `json:"cwd,omitempty"`
+	Project    string  `json:"project,omitempty"` // Filled in by the server from Cwd / Cmdline
+	Cmdline    string  `json:"cmdline"`
+}
+
+// IsWeb reports whether the process serves web requests (FPM or CGI)
+func (p PHPProcess) IsWeb() bool {
+	return p.Role == RoleFpmMaster || p.Role == RoleFpmWorker || p.Role == RoleCGI
+}
+
+// IsArtisan reports whether the process runs artisan (serve, workers, commands)
+func (p PHPProcess) IsArtisan() bool {
+	switch p.Role {
+	case RoleArtisanServe, RoleQueueWorker, RoleHorizon, RoleSchedule, RoleArtisan:
+		return true
+	}
+	return false
+}
+
 func (m *Monitor) getPHPStats() (int, int, float64, int) {
+	var webKB, cliKB uint64
+	var webCPU float64
+	var webWorkers int
+
+	for _, p := range m.GetProcesses() {
+		rss := uint64(p.RssMB * 1024 * 1024)
+		if p.IsWeb() {
+			// Web Process (FPM or CGI)
+			webKB += rss
+			webCPU += p.CpuPercent
+			webWorkers++
+		} else if p.IsArtisan() {
+			// CLI Process
+			cliKB += rss
+		}
+	}
+
+	return int(webKB / 1024 / 1024), int(cliKB / 1024 / 1024), webCPU, webWorkers
+}
+
+// GetProcesses lists every running PHP process
+func (m *Monitor) GetProcesses() []PHPProcess {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	pids, err := process.Pids()
 	if err != nil {
-		return 0, 0, 0.0, 0
+		return nil
 	}
 
 	// Track current PIDs to clean up old ones
 	currentPids := make(map[int32]bool)
 
-	var webKB, cliKB uint64
-	var webCPU float64
-	var webWorkers int
-
+	var result []PHPProcess
 	for _, pid := range pids {
 		currentPids[pid] = true
 
@@ -97,32 +162,27 @@ func (m *Monitor) getPHPStats() (int, int, float64, int) {
 		if err != nil {
 			continue
 		}
-		cmdline = strings.ToLower(cmdline)
+
+		p := PHPProcess{PID: pid, Cmdline: cmdline}
+		p.Role, p.Pool = classify(name, cmdline)
 
 		// Get Memory
-		memInfo, err := proc.MemoryInfo()
-		rss := uint64(0)
-		if err == nil && memInfo != nil {
-			rss = memInfo.RSS
+		if memInfo, err := proc.MemoryInfo(); err == nil && memInfo != nil {
+			p.RssMB = float64(memInfo.RSS) / 1024 / 1024
 		}
 
 		// Get CPU - This is stateful on 'proc'
-		cpuPercent, err := proc.CPUPercent()
-		if err != nil {
-			cpuPercent = 0.0
+		if cpuPercent, err := proc.CPUPercent(); err == nil {
+			p.CpuPercent = cpuPercent
 		}
 
-		// Heuristics
-		if strings.Contains(name, "fpm") || strings.Contains(name, "cgi") || strings.Contains(cmdline, "php-fpm") {
-			// Web Process (FPM or CGI)
-			webKB += rss
-			webCPU += cpuPercent
-			webWorkers++
-			// fmt.Printf("Found PHP-FPM: %s (PID: %d) CPU: %.2f%%\n", name, pid, cpuPercent)
-		} else if strings.Contains(cmdline, "artisan") || strings.Contains(cmdline, "serve") {
-			// CLI Process
-			cliKB += rss
+		if created, err := proc.CreateTime(); err == nil {
+			p.AgeSeconds = int64(time.Since(time.UnixMilli(created)).Seconds())
 		}
+		p.PPID, _ = proc.Ppid()
+		p.Cwd, _ = proc.Cwd() // Needs the same user (or root) on Linux
+
+		result = append(result, p)
 	}
 
 	// Cleanup old processes
@@ -132,27 +192,66 @@ func (m *Monitor) getPHPStats() (int, int, float64, int) {
 		}
 	}
 
-	return int(webKB / 1024 / 1024), int(cliKB / 1024 / 1024), webCPU, webWorkers
+	return result
+}
+
+// classify derives the role (and FPM pool) from the lowercased name and the cmdline.
+// Roles match case-insensitively; the pool keeps its case to match the FPM status page.
+func classify(name, cmdline string) (role, pool string) {
+	original := cmdline
+	cmdline = strings.ToLower(cmdline)
+
+	switch {
+	case strings.Contains(cmdline, "php-fpm: master process"):
+		return RoleFpmMaster, ""
+	case strings.Contains(cmdline, "php-fpm: pool "):
+		// FPM writes the title prefix in lowercase
+		if _, rest, ok := strings.Cut(original, "php-fpm: pool "); ok {
+			if fields := strings.Fields(rest); len(fields) > 0 {
+				pool = fields[0]
+			}
+		}
+		return RoleFpmWorker, pool
+	case strings.Contains(name, "fpm") || strings.Contains(cmdline, "php-fpm"):
+		return RoleFpmWorker, ""
+	case strings.Contains(name, "cgi"):
+		return RoleCGI, ""
+	case strings.Contains(cmdline, "queue:work") || strings.Contains(cmdline, "queue:listen"):
+		return RoleQueueWorker, ""
+	case strings.Contains(cmdline, "horizon"):
+		return RoleHorizon, ""
+	case strings.Contains(cmdline, "schedule:"):
+		return RoleSchedule, ""
+	case strings.Contains(cmdline, "serve") || strings.Contains(cmdline, "server.php"):
+		// artisan serve runs "php -S ... server.php" under the artisan process
+		return RoleArtisanServe, ""
+	case strings.Contains(cmdline, "artisan"):
+		return RoleArtisan, ""
+	}
+	return RoleCLI, ""
 }
 
 func (m *Monitor) GetStatus() Status {
 	stats := m.GetSystemStats()
+	fpmStatus, err := m.FpmStatus()
 
-	// Check FPM via Process Memory OR TCP Port
-	fpmStatus := stats.PhpWebMemoryMB > 0 || checkPHPFPM()
-
-	return Status{
-		PhpFpm:      fpmStatus,
-		SystemStats: stats,
+	// FPM is up if it answered FastCGI at all, or if we can see its processes
+	var respErr *fpm.ResponseError
+	status := Status{
+		PhpFpm:       stats.PhpWebMemoryMB > 0 || err == nil || errors.As(err, &respErr),
+		PhpFpmStatus: fpmStatus,
+		SystemStats:  stats,
+	}
+	if err != nil {
+		status.PhpFpmError = err.Error()
 	}
+	return status
 }
 
-func checkPHPFPM() bool {
-	// Try to connect to a common PHP-FPM socket or port
-	conn, err := net.DialTimeout("tcp", "127.0.0.1:9000", 100*time.Millisecond)
-	if err == nil {
-		conn.Close()
-		return true
+// FpmStatus queries the configured pool's status page over FastCGI
+func (m *Monitor) FpmStatus() (*fpm.Status, error) {
+	if m.fpm == nil {
+		return nil, errors.New("no php-fpm address configured")
 	}
-	return false
+	return m.fpm.Status()
 }
@@ -0,0 +1,70 @@
+package telemetry
+
+import (
+	"sort"
+
+	"github.com/mike/sentinel-agent/pkg/laravel"
+)
+
+// NPlusOneFinding is a query fingerprint repeated within single requests to one route
+type NPlusOneFinding struct {
+	Method   string  `json:"method"`
+	Route    string  `json:"route"`
+	SQL      string  `json:"sql"`
+	Requests int     `json:"requests"`  // Requests in which it was flagged
+	MaxCount int     `json:"max_count"` // Most repetitions seen in one request
+	TotalMS  float64 `json:"total_ms"`  // Time spent in the repeated query, summed over requests
+	LastSeen string  `json:"last_seen"`
+}
+
+// DetectNPlusOne returns the fingerprints repeated at least threshold times
+func DetectNPlusOne(fingerprints []laravel.QueryFingerprint, threshold int) []laravel.QueryFingerprint {
+	var flagged []laravel.QueryFingerprint
+	for _, fp := range fingerprints {
+		if fp.Count >= threshold {
+			flagged = append(flagged, fp)
+		}
+	}
+	return flagged
+}
+
+// FindNPlusOne groups the flagged fingerprints of entries by route, worst first
+func FindNPlusOne(entries []laravel.PerformanceEntry, normalize func(method, uri string) string) []NPlusOneFinding {
+	findings := make(map[string]*NPlusOneFinding)
+
+	for _, e := range entries {
+		if len(e.NPlusOne) == 0 {
+			continue
+		}
+		route := normalize(e.Method, e.URI)
+
+		for _, fp := range e.NPlusOne {
+			key := e.Method + " " + route + " " + fp.SQL
+			f, ok := findings[key]
+			if !ok {
+				f = &NPlusOneFinding{Method: e.Method, Route: route, SQL: fp.SQL}
+				findings[key] = f
+			}
+			f.Requests++
+			f.TotalMS += fp.TotalMS
+			if fp.Count > f.MaxCount {
+				f.MaxCount = fp.Count
+			}
+			if e.Timestamp > f.LastSeen {
+				f.LastSeen = e.Timestamp
+			}
+		}
+	}
+
+	result := make([]NPlusOneFinding, 0, len(findings))
+	for _, f := range findings {
+		result = append(result, *f)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].MaxCount != result[j].MaxCount {
+			return result[i].MaxCount > result[j].MaxCount
+		}
+		return result[i].Requests > result[j].Requests
+	})
+	return result
+}
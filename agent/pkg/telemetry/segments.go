@@ -0,0 +1,417 @@
+package telemetry
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/laravel"
+)
+
+const (
+	segmentExt      = ".seg"
+	segmentMaxBytes = 8 * 1024 * 1024
+	segmentMaxAge   = time.Hour
+)
+
+// Retention bounds how much history the segment log keeps
+type Retention struct {
+	MaxAge   time.Duration // 0 keeps everything
+	MaxBytes int64         // 0 means no size cap
+}
+
+// record is one NDJSON line in a segment file
+type record struct {
+	Time  int64                    `json:"t"` // Unix ms at ingest
+	Entry laravel.PerformanceEntry `json:"e"`
+}
+
+type segment struct {
+	path  string
+	start int64 // Unix ms of the first record, taken from the file name
+	size  int64
+}
+
+// SegmentLog is an append-only on-disk log of performance entries.
+// Records go to the active segment; sealed segments are only rewritten by Compact.
+// Each segment is named after its first record, so segment i covers
+// [start(i), start(i+1)).
+type SegmentLog struct {
+	dir       string
+	retention Retention
+
+	mu          sync.Mutex
+	active      *os.File
+	activeStart int64
+	activeSize  int64
+}
+
+func OpenSegmentLog(dir string, retention Retention) (*SegmentLog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create metrics dir: %v", err)
+	}
+	return &SegmentLog{dir: dir, retention: retention}, nil
+}
+
+// Append writes a record to the active segment, rolling over when it is full or old
+func (l *SegmentLog) Append(t time.Time, entry laravel.PerformanceEntry) error {
+	data, err := json.Marshal(record{Time: t.UnixMilli(), Entry: entry})
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active != nil && (l.activeSize >= segmentMaxBytes || t.UnixMilli()-l.activeStart >= segmentMaxAge.Milliseconds()) {
+		l.active.Close()
+		l.active = nil
+	}
+
+	if l.active == nil {
+		path := filepath.Join(l.dir, segmentName(t.UnixMilli()))
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		stat, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		l.active = file
+		l.activeStart = t.UnixMilli()
+		l.activeSize = stat.Size()
+	}
+
+	n, err := l.active.Write(data)
+	l.activeSize += int64(n)
+	return err
+}
+
+// Query returns entries ingested within [from, to]. Zero times leave that end open.
+func (l *SegmentLog) Query(from, to time.Time) ([]laravel.PerformanceEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	segments, err := l.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	fromMS, toMS := int64(0), int64(1<<62)
+	if !from.IsZero() {
+		fromMS = from.UnixMilli()
+	}
+	if !to.IsZero() {
+		toMS = to.UnixMilli()
+	}
+
+	entries := []laravel.PerformanceEntry{}
+	for i, seg := range segments {
+		// Skip segments that end before the window or start after it
+		if i+1 < len(segments) && segments[i+1].start < fromMS {
+			continue
+		}
+		if seg.start > toMS {
+			break
+		}
+
+		err := readSegment(seg.path, func(rec record) {
+			if rec.Time >= fromMS && rec.Time <= toMS {
+				entries = append(entries, rec.Entry)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Last returns the newest n entries, oldest first
+func (l *SegmentLog) Last(n int) ([]laravel.PerformanceEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	segments, err := l.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []laravel.PerformanceEntry
+	for i := len(segments) - 1; i >= 0 && len(entries) < n; i-- {
+		var chunk []laravel.PerformanceEntry
+		err := readSegment(segments[i].path, func(rec record) {
+			chunk = append(chunk, rec.Entry)
+		})
+		if err != nil {
+			return nil, err
+		}
+		entries = append(chunk, entries...)
+	}
+
+	if len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	return entries, nil
+}
+
+// Clear deletes every segment
+func (l *SegmentLog) Clear() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closeActive()
+
+	segments, err := l.segments()
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compact applies retention and merges small sealed segments.
+// 1. Drops segments entirely older than MaxAge.
+// 2. Rewrites runs of small segments into one, dropping expired records.
+// 3. Drops the oldest segments until the log fits in MaxBytes.
+func (l *SegmentLog) Compact() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Seal the active segment so every file is safe to rewrite
+	l.closeActive()
+
+	segments, err := l.segments()
+	if err != nil {
+		return err
+	}
+
+	cutoff := int64(0)
+	if l.retention.MaxAge > 0 {
+		cutoff = time.Now().Add(-l.retention.MaxAge).UnixMilli()
+	}
+
+	// 1. Age
+	var kept []segment
+	for i, seg := range segments {
+		if cutoff > 0 && i+1 < len(segments) && segments[i+1].start < cutoff {
+			os.Remove(seg.path)
+			continue
+		}
+		kept = append(kept, seg)
+	}
+
+	// 2. Merge
+	var merged []segment
+	var run []segment
+	var runSize int64
+	flushRun := func() error {
+		if len(run) > 0 {
+			seg, err := l.mergeSegments(run, cutoff)
+			if err != nil {
+				return err
+			}
+			if seg != nil {
+				merged = append(merged, *seg)
+			}
+		}
+		run, runSize = nil, 0
+		return nil
+	}
+	for _, seg := range kept {
+		if runSize+seg.size > segmentMaxBytes {
+			if err := flushRun(); err != nil {
+				return err
+			}
+		}
+		run = append(run, seg)
+		runSize += seg.size
+	}
+	if err := flushRun(); err != nil {
+		return err
+	}
+
+	// 3. Size
+	if l.retention.MaxBytes > 0 {
+		var total int64
+		for _, seg := range merged {
+			total += seg.size
+		}
+		for len(merged) > 1 && total > l.retention.MaxBytes {
+			os.Remove(merged[0].path)
+			total -= merged[0].size
+			merged = merged[1:]
+		}
+	}
+
+	return nil
+}
+
+// mergeSegments rewrites run into a single segment named after its first live record.
+// Returns nil if every record had expired.
+func (l *SegmentLog) mergeSegments(run []segment, cutoff int64) (*segment, error) {
+	// A lone segment with nothing to expire is left as is
+	if len(run) == 1 && run[0].start >= cutoff {
+		return &run[0], nil
+	}
+
+	tmpPath := filepath.Join(l.dir, "compact.tmp")
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	discard := func(err error) (*segment, error) {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	w := bufio.NewWriter(tmp)
+	first := int64(-1)
+	var writeErr error
+	for _, seg := range run {
+		err := readSegment(seg.path, func(rec record) {
+			if rec.Time < cutoff || writeErr != nil {
+				return
+			}
+			if first == -1 {
+				first = rec.Time
+			}
+			data, _ := json.Marshal(rec)
+			_, writeErr = w.Write(append(data, '\n'))
+		})
+		if err != nil {
+			return discard(err)
+		}
+		if writeErr != nil {
+			return discard(writeErr)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return discard(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return discard(err)
+	}
+	stat, err := tmp.Stat()
+	if err != nil {
+		return discard(err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	// Put the merged segment in place before removing its sources, so a crash
+	// in between leaves duplicated records rather than losing them
+	var path string
+	if first != -1 {
+		path = filepath.Join(l.dir, segmentName(first))
+		if err := os.Rename(tmpPath, path); err != nil {
+			os.Remove(tmpPath)
+			return nil, err
+		}
+	} else {
+		os.Remove(tmpPath)
+	}
+
+	for _, seg := range run {
+		if seg.path != path {
+			os.Remove(seg.path)
+		}
+	}
+
+	if first == -1 {
+		return nil, nil
+	}
+	return &segment{path: path, start: first, size: stat.Size()}, nil
+}
+
+func (l *SegmentLog) closeActive() {
+	if l.active != nil {
+		l.active.Close()
+		l.active = nil
+	}
+}
+
+// segments lists segment files oldest first
+func (l *SegmentLog) segments() ([]segment, error) {
+	dirEntries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []segment
+	for _, de := range dirEntries {
+		name := de.Name()
+		if de.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		start, err := strconv.ParseInt(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment{
+			path:  filepath.Join(l.dir, name),
+			start: start,
+			size:  info.Size(),
+		})
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i].start < segments[j].start })
+	return segments, nil
+}
+
+// readSegment calls fn for every decodable record.
+// A torn last line (e.g. after a crash) is skipped rather than failing the read.
+func readSegment(path string, fn func(record)) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var rec record
+			if json.Unmarshal(line, &rec) == nil {
+				fn(rec)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Zero-padded so lexical and numeric order agree
+func segmentName(startMS int64) string {
+	return fmt.Sprintf("%016d%s", startMS, segmentExt)
+}
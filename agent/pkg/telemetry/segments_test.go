@@ -0,0 +1,215 @@
+package telemetry
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/laravel"
+)
+
+// appendHourly writes one entry per hour from base, so every entry starts a new segment.
+// Entry i has URI "/i".
+func appendHourly(t *testing.T, log *SegmentLog, base time.Time, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		entry := laravel.PerformanceEntry{URI: "/" + string(rune('0'+i))}
+		if err := log.Append(base.Add(time.Duration(i)*time.Hour), entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func uris(entries []laravel.PerformanceEntry) []string {
+	out := []string{}
+	for _, e := range entries {
+		out = append(out, e.URI)
+	}
+	return out
+}
+
+func segmentCount(t *testing.T, log *SegmentLog) int {
+	t.Helper()
+	segments, err := log.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(segments)
+}
+
+func TestSegmentQueryRanges(t *testing.T) {
+	log, err := OpenSegmentLog(t.TempDir(), Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	appendHourly(t, log, base, 6)
+
+	if got := segmentCount(t, log); got != 6 {
+		t.Fatalf("got %d segments, want 6", got)
+	}
+
+	hour := func(h float64) time.Time { return base.Add(time.Duration(h * float64(time.Hour))) }
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []string
+	}{
+		{"open both ends", time.Time{}, time.Time{}, []string{"/0", "/1", "/2", "/3", "/4", "/5"}},
+		{"open start", time.Time{}, hour(2), []string{"/0", "/1", "/2"}},
+		{"open end", hour(3), time.Time{}, []string{"/3", "/4", "/5"}},
+		{"inclusive bounds", hour(1), hour(3), []string{"/1", "/2", "/3"}},
+		{"single instant", hour(4), hour(4), []string{"/4"}},
+		{"inside one segment", hour(1.25), hour(1.75), []string{}},
+		{"before everything", hour(-3), hour(-1), []string{}},
+		{"after everything", hour(6), hour(9), []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := log.Query(tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := uris(entries); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSegmentQuerySkipsTornLine(t *testing.T) {
+	dir := t.TempDir()
+	log, err := OpenSegmentLog(dir, Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	appendHourly(t, log, base, 2)
+	log.closeActive()
+
+	// A crash mid-write leaves half a record at the end of the active segment
+	path := filepath.Join(dir, segmentName(base.Add(time.Hour).UnixMilli()))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"t":1,"e":{"uri":"/torn"`)
+	file.Close()
+
+	entries, err := log.Query(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := uris(entries), []string{"/0", "/1"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSegmentCompact(t *testing.T) {
+	// Retention.MaxAge is measured from now, so entries are laid out up to now
+	base := time.Now().Add(-5 * time.Hour)
+
+	tests := []struct {
+		name         string
+		maxAge       time.Duration
+		wantURIs     []string
+		wantSegments int
+	}{
+		{"keep everything merges small segments", 0, []string{"/0", "/1", "/2", "/3", "/4", "/5"}, 1},
+		{"drops expired entries", 150 * time.Minute, []string{"/3", "/4", "/5"}, 1},
+		{"keeps only the newest", 30 * time.Minute, []string{"/5"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, err := OpenSegmentLog(t.TempDir(), Retention{MaxAge: tt.maxAge})
+			if err != nil {
+				t.Fatal(err)
+			}
+			appendHourly(t, log, base, 6)
+
+			if err := log.Compact(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := segmentCount(t, log); got != tt.wantSegments {
+				t.Errorf("got %d segments, want %d", got, tt.wantSegments)
+			}
+			entries, err := log.Query(time.Time{}, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := uris(entries); !slices.Equal(got, tt.wantURIs) {
+				t.Errorf("got %v, want %v", got, tt.wantURIs)
+			}
+
+			// The merged segment is named after its first live record, so range queries still find it
+			first, err := log.Query(base.Add(-time.Minute), base.Add(5*time.Hour+time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := uris(first); !slices.Equal(got, tt.wantURIs) {
+				t.Errorf("range query got %v, want %v", got, tt.wantURIs)
+			}
+		})
+	}
+}
+
+func TestSegmentCompactMaxBytes(t *testing.T) {
+	log, err := OpenSegmentLog(t.TempDir(), Retention{MaxBytes: 11 * 1024 * 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Three ~5MB segments: too big to merge with each other, 15MB together
+	big := strings.Repeat("x", 5*1024*1024)
+	base := time.Now().Add(-3 * time.Hour)
+	for i := 0; i < 3; i++ {
+		entry := laravel.PerformanceEntry{URI: "/" + string(rune('0'+i)), Action: big}
+		if err := log.Append(base.Add(time.Duration(i)*time.Hour), entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := log.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := segmentCount(t, log); got != 2 {
+		t.Errorf("got %d segments, want 2", got)
+	}
+	entries, err := log.Query(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := uris(entries), []string{"/1", "/2"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSegmentCompactThenAppend(t *testing.T) {
+	log, err := OpenSegmentLog(t.TempDir(), Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Now().Add(-2 * time.Hour)
+	appendHourly(t, log, base, 2)
+
+	if err := log.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	// Compaction sealed the active segment; the next append opens a new one
+	if err := log.Append(base.Add(90*time.Minute), laravel.PerformanceEntry{URI: "/new"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := log.Last(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := uris(entries), []string{"/1", "/new"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
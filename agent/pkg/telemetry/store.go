@@ -1,56 +1,267 @@
 package telemetry
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/mike/sentinel-agent/pkg/laravel"
 )
 
-// Store creates a ring buffer or time-window store for metrics
+// Name of the file recording which project a partition directory belongs to
+const partitionProjectFile = "PROJECT"
+
+// Store creates a ring buffer or time-window store for metrics, partitioned by project.
+// When persistent, every partition also owns a SegmentLog under
+// <dir>/<hash of project path> and the ring buffer only caches recent entries.
+// mu guards the partitions and ring buffers only; disk I/O happens after
+// releasing it, under the SegmentLog's own lock, so a long query or compaction
+// never holds up ingest.
 type Store struct {
+	partitions map[string]*partition // Key: ProjectPath
+	mu         sync.RWMutex
+	limit      int
+	dir        string // "" for memory-only stores
+	retention  Retention
+}
+
+type partition struct {
 	entries []laravel.PerformanceEntry
-	mu      sync.RWMutex
-	limit   int
+	log     *SegmentLog
 }
 
 func NewStore(limit int) *Store {
 	return &Store{
-		entries: make([]laravel.PerformanceEntry, 0, limit),
-		limit:   limit,
+		partitions: make(map[string]*partition),
+		limit:      limit,
+	}
+}
+
+// OpenStore returns a Store persisted under dir.
+// The newest entries of each project are replayed into memory so history survives restarts.
+func OpenStore(dir string, limit int, retention Retention) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create metrics dir: %v", err)
+	}
+
+	s := NewStore(limit)
+	s.dir = dir
+	s.retention = retention
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, de := range dirEntries {
+		if !de.IsDir() {
+			continue
+		}
+		projectPath, err := os.ReadFile(filepath.Join(dir, de.Name(), partitionProjectFile))
+		if err != nil {
+			continue
+		}
+
+		log, err := OpenSegmentLog(filepath.Join(dir, de.Name()), retention)
+		if err != nil {
+			return nil, err
+		}
+		recent, err := log.Last(limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to replay metrics: %v", err)
+		}
+		s.partitions[string(projectPath)] = &partition{entries: recent, log: log}
+	}
+
+	return s, nil
+}
+
+// partitionFor returns the project's partition, creating it if needed. Caller holds the write lock.
+func (s *Store) partitionFor(projectPath string) (*partition, error) {
+	if p, ok := s.partitions[projectPath]; ok {
+		return p, nil
+	}
+
+	p := &partition{entries: make([]laravel.PerformanceEntry, 0, s.limit)}
+	if s.dir != "" {
+		sum := sha1.Sum([]byte(projectPath))
+		partDir := filepath.Join(s.dir, hex.EncodeToString(sum[:8]))
+
+		log, err := OpenSegmentLog(partDir, s.retention)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(partDir, partitionProjectFile), []byte(projectPath), 0644); err != nil {
+			return nil, err
+		}
+		p.log = log
 	}
+
+	s.partitions[projectPath] = p
+	return p, nil
 }
 
 func (s *Store) Add(entry laravel.PerformanceEntry) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	now := time.Now()
 
 	// Ensure timestamp if missing
 	if entry.Timestamp == "" {
-		entry.Timestamp = time.Now().Format("2006-01-02 15:04:05")
+		entry.Timestamp = now.Format("2006-01-02 15:04:05")
+	}
+
+	s.mu.Lock()
+	p, err := s.partitionFor(entry.Project)
+	if err != nil {
+		s.mu.Unlock()
+		fmt.Printf("[Store] Failed to open partition for %s: %v\n", entry.Project, err)
+		return
 	}
 
 	// Simple append
-	s.entries = append(s.entries, entry)
+	p.entries = append(p.entries, entry)
+
+	// Ring buffer logic (keep last N per project)
+	if len(p.entries) > s.limit {
+		p.entries = p.entries[len(p.entries)-s.limit:]
+	}
+	log := p.log
+	s.mu.Unlock()
 
-	// Ring buffer logic (keep last N)
-	if len(s.entries) > s.limit {
-		s.entries = s.entries[len(s.entries)-s.limit:]
+	if log != nil {
+		if err := log.Append(now, entry); err != nil {
+			fmt.Printf("[Store] Failed to persist entry: %v\n", err)
+		}
 	}
 }
 
-func (s *Store) GetAll() []laravel.PerformanceEntry {
+// GetAll returns the cached recent entries of a project, or of every project if projectPath is empty
+func (s *Store) GetAll(projectPath string) []laravel.PerformanceEntry {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	// Return copy
-	msgs := make([]laravel.PerformanceEntry, len(s.entries))
-	copy(msgs, s.entries)
+	msgs := []laravel.PerformanceEntry{}
+	for key, p := range s.partitions {
+		if projectPath == "" || key == projectPath {
+			msgs = append(msgs, p.entries...)
+		}
+	}
+	if projectPath == "" {
+		sortByTimestamp(msgs)
+	}
 	return msgs
 }
 
-func (s *Store) Clear() {
+// Query returns a project's entries recorded within [from, to]; zero times leave that end open
+// and an empty projectPath covers every project.
+// Persistent stores read from disk, memory-only stores filter the ring buffer.
+func (s *Store) Query(projectPath string, from, to time.Time) ([]laravel.PerformanceEntry, error) {
+	msgs := []laravel.PerformanceEntry{}
+	var logs []*SegmentLog
+
+	s.mu.RLock()
+	for key, p := range s.partitions {
+		if projectPath != "" && key != projectPath {
+			continue
+		}
+
+		if p.log != nil {
+			logs = append(logs, p.log)
+			continue
+		}
+
+		for _, entry := range p.entries {
+			ts, err := time.ParseInLocation("2006-01-02 15:04:05", entry.Timestamp, time.Local)
+			if err != nil {
+				continue
+			}
+			if (!from.IsZero() && ts.Before(from)) || (!to.IsZero() && ts.After(to)) {
+				continue
+			}
+			msgs = append(msgs, entry)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, log := range logs {
+		stored, err := log.Query(from, to)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, stored...)
+	}
+	if projectPath == "" {
+		sortByTimestamp(msgs)
+	}
+	return msgs, nil
+}
+
+// Projects lists the projects with stored metrics
+func (s *Store) Projects() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var projects []string
+	for key := range s.partitions {
+		projects = append(projects, key)
+	}
+	sort.Strings(projects)
+	return projects
+}
+
+// Compact applies the retention policy to every on-disk partition
+func (s *Store) Compact() error {
+	logs := make(map[string]*SegmentLog)
+	s.mu.RLock()
+	for key, p := range s.partitions {
+		if p.log != nil {
+			logs[key] = p.log
+		}
+	}
+	s.mu.RUnlock()
+
+	var failed []string
+	for key, log := range logs {
+		if err := log.Compact(); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("compaction failed for %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Clear drops a project's metrics, or every project's if projectPath is empty
+func (s *Store) Clear(projectPath string) {
+	var logs []*SegmentLog
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.entries = []laravel.PerformanceEntry{}
+	for key, p := range s.partitions {
+		if projectPath != "" && key != projectPath {
+			continue
+		}
+		p.entries = []laravel.PerformanceEntry{}
+		if p.log != nil {
+			logs = append(logs, p.log)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, log := range logs {
+		if err := log.Clear(); err != nil {
+			fmt.Printf("[Store] Failed to clear metrics: %v\n", err)
+		}
+	}
+}
+
+// Timestamps are "Y-m-d H:i:s", so string order is chronological
+func sortByTimestamp(entries []laravel.PerformanceEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp < entries[j].Timestamp
+	})
 }
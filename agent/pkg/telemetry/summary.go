@@ -0,0 +1,100 @@
+package telemetry
+
+import (
+	"math"
+	"sort"
+
+	"github.com/mike/sentinel-agent/pkg/laravel"
+)
+
+// RouteSummary aggregates the entries of one method + route
+type RouteSummary struct {
+	Method      string  `json:"method"`
+	Route       string  `json:"route"`
+	Count       int     `json:"count"`
+	P50MS       float64 `json:"p50_ms"`
+	P95MS       float64 `json:"p95_ms"`
+	P99MS       float64 `json:"p99_ms"`
+	MaxMemoryMB float64 `json:"max_memory_mb"`
+	MeanQueries float64 `json:"mean_queries"`
+	ErrorRate   float64 `json:"error_rate"` // Share of entries counted by IsError
+}
+
+// Summarize groups entries by method and normalized route, slowest p95 first.
+// normalize maps a raw URI to its route pattern.
+func Summarize(entries []laravel.PerformanceEntry, normalize func(method, uri string) string) []RouteSummary {
+	type group struct {
+		summary   RouteSummary
+		durations []float64
+		queries   int
+		errors    int
+	}
+
+	groups := make(map[string]*group)
+	var order []string
+
+	for _, e := range entries {
+		route := normalize(e.Method, e.URI)
+		key := e.Method + " " + route
+
+		g, ok := groups[key]
+		if !ok {
+			g = &group{summary: RouteSummary{Method: e.Method, Route: route}}
+			groups[key] = g
+			order = append(order, key)
+		}
+
+		g.durations = append(g.durations, e.DurationMS)
+		g.queries += e.QueryCount
+		if e.MemoryMB > g.summary.MaxMemoryMB {
+			g.summary.MaxMemoryMB = e.MemoryMB
+		}
+		if IsError(e) {
+			g.errors++
+		}
+	}
+
+	summaries := make([]RouteSummary, 0, len(groups))
+	for _, key := range order {
+		g := groups[key]
+		sort.Float64s(g.durations)
+
+		s := g.summary
+		s.Count = len(g.durations)
+		s.P50MS = Percentile(g.durations, 50)
+		s.P95MS = Percentile(g.durations, 95)
+		s.P99MS = Percentile(g.durations, 99)
+		s.MeanQueries = float64(g.queries) / float64(s.Count)
+		s.ErrorRate = float64(g.errors) / float64(s.Count)
+		summaries = append(summaries, s)
+	}
+
+	sort.SliceStable(summaries, func(i, j int) bool { return summaries[i].P95MS > summaries[j].P95MS })
+	return summaries
+}
+
+// FilterKind keeps the entries of the given kinds (see laravel.KindRequest and friends)
+func FilterKind(entries []laravel.PerformanceEntry, kinds ...string) []laravel.PerformanceEntry {
+	filtered := make([]laravel.PerformanceEntry, 0, len(entries))
+	for _, e := range entries {
+		for _, kind := range kinds {
+			if e.EntryKind() == kind {
+				filtered = append(filtered, e)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// Percentile uses the nearest-rank method on sorted values
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,289 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mike/sentinel-agent/pkg/laravel"
+)
+
+const (
+	traceExt      = ".json"
+	traceMaxFiles = 5000 // Upper bound on persisted traces, whatever the retention
+)
+
+// Trace ids are hex, which also keeps them safe to use as file names
+var traceIDRe = regexp.MustCompile(`^[0-9a-f]{16,64}$`)
+
+// Trace is the span tree of one request
+type Trace struct {
+	ID         string         `json:"id"`
+	Project    string         `json:"project"`
+	Method     string         `json:"method"`
+	URI        string         `json:"uri"`
+	Status     int            `json:"status,omitempty"`
+	DurationMS float64        `json:"duration_ms"`
+	Timestamp  string         `json:"timestamp"`
+	Spans      []laravel.Span `json:"spans"` // Sorted by start
+}
+
+// TraceSummary lists a trace without its spans
+type TraceSummary struct {
+	ID         string  `json:"id"`
+	Method     string  `json:"method"`
+	URI        string  `json:"uri"`
+	Status     int     `json:"status,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+	Timestamp  string  `json:"timestamp"`
+	SpanCount  int     `json:"span_count"`
+}
+
+// TraceStore keeps the newest traces in memory and, when persistent,
+// every trace as <dir>/<id>.json until Compact drops it.
+type TraceStore struct {
+	mu     sync.RWMutex
+	recent map[string]*Trace
+	order  []string // Oldest first
+	limit  int
+	dir    string // "" for memory-only stores
+	maxAge time.Duration
+}
+
+// ValidTraceID reports whether id looks like a trace id from the probe
+func ValidTraceID(id string) bool {
+	return traceIDRe.MatchString(id)
+}
+
+// TraceFromEntry builds a trace from an ingested entry carrying spans
+func TraceFromEntry(entry laravel.PerformanceEntry) Trace {
+	spans := append([]laravel.Span(nil), entry.Spans...)
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].StartMS < spans[j].StartMS })
+
+	return Trace{
+		ID:         entry.TraceID,
+		Project:    entry.Project,
+		Method:     entry.Method,
+		URI:        entry.URI,
+		Status:     entry.Status,
+		DurationMS: entry.DurationMS,
+		Timestamp:  entry.Timestamp,
+		Spans:      spans,
+	}
+}
+
+func NewTraceStore(limit int) *TraceStore {
+	return &TraceStore{
+		recent: make(map[string]*Trace),
+		limit:  limit,
+	}
+}
+
+// OpenTraceStore returns a TraceStore persisted under dir, with the newest traces replayed
+func OpenTraceStore(dir string, limit int, maxAge time.Duration) (*TraceStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create traces dir: %v", err)
+	}
+
+	s := NewTraceStore(limit)
+	s.dir = dir
+	s.maxAge = maxAge
+
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > limit {
+		files = files[len(files)-limit:]
+	}
+	for _, f := range files {
+		trace, err := readTrace(f.path)
+		if err != nil {
+			continue
+		}
+		s.remember(trace)
+	}
+
+	return s, nil
+}
+
+func (s *TraceStore) Add(trace Trace) error {
+	if !ValidTraceID(trace.ID) {
+		return fmt.Errorf("invalid trace id: %q", trace.ID)
+	}
+
+	s.mu.Lock()
+	s.remember(&trace)
+	s.mu.Unlock()
+
+	if s.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(trace)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, trace.ID+traceExt), data, 0644)
+}
+
+// remember adds a trace to the in-memory ring. Caller holds the write lock.
+func (s *TraceStore) remember(trace *Trace) {
+	if _, ok := s.recent[trace.ID]; !ok {
+		s.order = append(s.order, trace.ID)
+	}
+	s.recent[trace.ID] = trace
+
+	for len(s.order) > s.limit {
+		delete(s.recent, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// Get returns a trace by id, or nil if it is unknown or expired
+func (s *TraceStore) Get(id string) (*Trace, error) {
+	if !ValidTraceID(id) {
+		return nil, nil
+	}
+
+	s.mu.RLock()
+	trace, ok := s.recent[id]
+	s.mu.RUnlock()
+	if ok {
+		return trace, nil
+	}
+
+	if s.dir == "" {
+		return nil, nil
+	}
+	trace, err := readTrace(filepath.Join(s.dir, id+traceExt))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return trace, err
+}
+
+// List returns the newest traces of a project, newest first ("" means all projects)
+func (s *TraceStore) List(projectPath string, n int) []TraceSummary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []TraceSummary{}
+	for i := len(s.order) - 1; i >= 0 && len(result) < n; i-- {
+		t := s.recent[s.order[i]]
+		if projectPath != "" && t.Project != projectPath {
+			continue
+		}
+		result = append(result, TraceSummary{
+			ID:         t.ID,
+			Method:     t.Method,
+			URI:        t.URI,
+			Status:     t.Status,
+			DurationMS: t.DurationMS,
+			Timestamp:  t.Timestamp,
+			SpanCount:  len(t.Spans),
+		})
+	}
+	return result
+}
+
+// Compact deletes persisted traces older than the retention, then the oldest beyond traceMaxFiles
+func (s *TraceStore) Compact() error {
+	if s.dir == "" {
+		return nil
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-s.maxAge)
+	for i, f := range files {
+		expired := s.maxAge > 0 && f.modTime.Before(cutoff)
+		if !expired && len(files)-i <= traceMaxFiles {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clear drops the traces of a project ("" means all projects)
+func (s *TraceStore) Clear(projectPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.order[:0]
+	for _, id := range s.order {
+		if projectPath == "" || s.recent[id].Project == projectPath {
+			delete(s.recent, id)
+			continue
+		}
+		kept = append(kept, id)
+	}
+	s.order = kept
+
+	if s.dir == "" {
+		return
+	}
+	files, err := s.files()
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		if projectPath != "" {
+			trace, err := readTrace(f.path)
+			if err != nil || trace.Project != projectPath {
+				continue
+			}
+		}
+		os.Remove(f.path)
+	}
+}
+
+type traceFile struct {
+	path    string
+	modTime time.Time
+}
+
+// files lists the persisted traces, oldest first
+func (s *TraceStore) files() ([]traceFile, error) {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []traceFile
+	for _, de := range dirEntries {
+		if de.IsDir() || !strings.HasSuffix(de.Name(), traceExt) {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, traceFile{path: filepath.Join(s.dir, de.Name()), modTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	return files, nil
+}
+
+func readTrace(path string) (*Trace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var trace Trace
+	if err := json.Unmarshal(data, &trace); err != nil {
+		return nil, fmt.Errorf("failed to read trace %s: %v", filepath.Base(path), err)
+	}
+	return &trace, nil
+}
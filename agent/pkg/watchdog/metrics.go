@@ -0,0 +1,66 @@
+package watchdog
+
+import (
+	"fmt"
+
+	"github.com/mike/sentinel-agent/pkg/config"
+)
+
+// Metrics rules can watch
+const (
+	// PHP processes (Monitor)
+	MetricFpmCPU      = "php_fpm_cpu_percent"
+	MetricFpmWorkers  = "php_fpm_workers"
+	MetricWebMemoryMB = "php_web_memory_mb"
+	MetricCliMemoryMB = "php_cli_memory_mb"
+
+	// FPM status page
+	MetricFpmSaturation  = "php_fpm_saturation_percent" // Active workers / total workers
+	MetricFpmListenQueue = "php_fpm_listen_queue"
+
+	// Agent
+	MetricAgentMemoryMB = "agent_memory_mb"
+
+	// Ingested requests over the rule's window (Store)
+	MetricP95LatencyMS   = "p95_latency_ms"
+	MetricErrorRate      = "error_rate_percent"
+	MetricRequestsPerMin = "requests_per_minute"
+
+	// Laravel log over the rule's window
+	MetricDeadlocks = "deadlock_count"
+)
+
+var metrics = map[string]bool{
+	MetricFpmCPU:         true,
+	MetricFpmWorkers:     true,
+	MetricWebMemoryMB:    true,
+	MetricCliMemoryMB:    true,
+	MetricFpmSaturation:  true,
+	MetricFpmListenQueue: true,
+	MetricAgentMemoryMB:  true,
+	MetricP95LatencyMS:   true,
+	MetricErrorRate:      true,
+	MetricRequestsPerMin: true,
+	MetricDeadlocks:      true,
+}
+
+var severities = map[string]bool{"": true, "info": true, "warning": true, "critical": true}
+
+// ValidateRule rejects rules the watchdog can't evaluate
+func ValidateRule(rule config.Rule) error {
+	if !metrics[rule.Metric] {
+		return fmt.Errorf("unknown metric %q", rule.Metric)
+	}
+	switch rule.Comparison {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return fmt.Errorf("invalid comparison %q", rule.Comparison)
+	}
+	if !severities[rule.Severity] {
+		return fmt.Errorf("invalid severity %q", rule.Severity)
+	}
+	if rule.ForSeconds < 0 || rule.CooldownSeconds < 0 || rule.ExpireSeconds < 0 || rule.WindowSeconds < 0 {
+		return fmt.Errorf("durations must not be negative")
+	}
+	return nil
+}
@@ -1,100 +1,498 @@
 package watchdog
 
 import (
-	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
+
+	"github.com/mike/sentinel-agent/pkg/config"
+	"github.com/mike/sentinel-agent/pkg/nginx"
+	"github.com/mike/sentinel-agent/pkg/telemetry"
+)
+
+// Per-rule defaults
+const (
+	defaultCooldown = 1 * time.Minute
+	defaultExpiry   = 5 * time.Minute
+	defaultSeverity = "warning"
+)
+
+// Incidents kept in the log, oldest resolved ones dropped first
+const maxHistory = 500
+
+// Suspects and correlated entries are looked for from this long before the breach began
+const suspectLead = 1 * time.Minute
+
+// Incident states
+const (
+	StateOpen         = "open"
+	StateAcknowledged = "acknowledged" // Still breached, but someone has seen it
+	StateResolved     = "resolved"
 )
 
+var ErrIncidentNotFound = errors.New("incident not found")
+
 type Incident struct {
-	Timestamp       time.Time `json:"timestamp"`
-	CpuPercent      float64   `json:"cpu_percent"`
-	SuspectRequests []string  `json:"suspect_requests"`
+	ID              string                 `json:"id"`
+	State           string                 `json:"state"`
+	Timestamp       time.Time              `json:"timestamp"` // When the incident opened
+	EndedAt         *time.Time             `json:"ended_at,omitempty"`
+	AcknowledgedAt  *time.Time             `json:"acknowledged_at,omitempty"`
+	Rule            string                 `json:"rule"`
+	Metric          string                 `json:"metric"`
+	Severity        string                 `json:"severity"`
+	Value           float64                `json:"value"`      // When it opened
+	PeakValue       float64                `json:"peak_value"` // Furthest past the threshold while open
+	Comparison      string                 `json:"comparison"`
+	Threshold       float64                `json:"threshold"`
+	Message         string                 `json:"message"`
+	CpuPercent      float64                `json:"cpu_percent"`      // FPM CPU when the incident opened
+	SuspectRequests []string               `json:"suspect_requests"` // Raw log lines of the slowest suspects
+	Suspects        *nginx.Suspects        `json:"suspects,omitempty"`
+	Correlation     *telemetry.Correlation `json:"correlation,omitempty"` // Ingested entries and PHP processes of the breach window
+	ExpiresAt       *time.Time             `json:"expires_at,omitempty"`  // Resolved incidents leave /alerts after this
+}
+
+// AccessLog is the nginx log incidents take their suspects from
+type AccessLog struct {
+	Path   string
+	Format *nginx.Format
+}
+
+// ValueFunc returns the current value of a rule's metric, false when it's unavailable
+type ValueFunc func(rule config.Rule) (float64, bool)
+
+// CorrelateFunc gathers the agent's own data on a rule's breach window
+type CorrelateFunc func(rule config.Rule, from, to time.Time) *telemetry.Correlation
+
+// RunningFunc lists the requests being served right now, which the access log doesn't have yet
+type RunningFunc func() []nginx.Running
+
+// Sources are what Check reads metrics and incident context from
+type Sources struct {
+	Value     ValueFunc
+	AccessLog AccessLog
+	Correlate CorrelateFunc // Optional
+	Running   RunningFunc   // Optional
+}
+
+// ruleState tracks one rule between checks
+type ruleState struct {
+	breachSince   time.Time // Zero while the rule isn't breached
+	cooldownUntil time.Time
+	incident      *Incident // Open incident of the rule, if any
 }
 
 type Watchdog struct {
-	mu            sync.RWMutex
-	LastIncident  *Incident
-	CooldownUntil time.Time
+	mu      sync.RWMutex
+	rules   map[string]*ruleState // Key: RuleKey
+	history []*Incident           // Oldest first
+	path    string                // "" for memory-only watchdogs
 }
 
 func New() *Watchdog {
-	return &Watchdog{}
+	return &Watchdog{rules: make(map[string]*ruleState)}
+}
+
+// Open returns a Watchdog whose incident log is persisted at path.
+// Incidents still open are picked up again by their rules.
+func Open(path string) (*Watchdog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create incidents dir: %v", err)
+	}
+
+	w := New()
+	w.path = path
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return w, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read incidents: %v", err)
+	}
+	if err := json.Unmarshal(data, &w.history); err != nil {
+		return nil, fmt.Errorf("failed to parse incidents: %v", err)
+	}
+
+	for _, incident := range w.history {
+		if incident.State != StateResolved {
+			w.rules[incident.Rule] = &ruleState{breachSince: incident.Timestamp, incident: incident}
+		}
+	}
+	return w, nil
 }
 
-func (w *Watchdog) Check(cpuPercent float64, threshold int, logPath string) *Incident {
+// Check evaluates every enabled rule and returns the incidents that opened or resolved
+func (w *Watchdog) Check(rules []config.Rule, src Sources) []Incident {
+	// Metric values may come from FastCGI, Store queries or log scans, so they
+	// are read before taking the lock that /alerts and ack need
+	type reading struct {
+		value float64
+		ok    bool
+	}
+	readings := make(map[string]reading)
+	for _, rule := range rules {
+		if !rule.Disabled {
+			v, ok := src.Value(rule)
+			readings[RuleKey(rule)] = reading{v, ok}
+		}
+	}
+
+	// Rules that breached for long enough; their incidents are built after
+	// unlocking, since suspects and correlation scan logs and stores
+	type breach struct {
+		rule  config.Rule
+		key   string
+		value float64
+		since time.Time
+	}
+	var opening []breach
+
+	w.mu.Lock()
+
+	now := time.Now()
+	var changed []*Incident
+	dirty := false
+	seen := make(map[string]bool)
+
+	for _, rule := range rules {
+		if rule.Disabled {
+			continue
+		}
+		key := RuleKey(rule)
+		seen[key] = true
+
+		state, ok := w.rules[key]
+		if !ok {
+			state = &ruleState{}
+			w.rules[key] = state
+		}
+
+		// 1. Is the rule breached right now? Unknown values leave everything as it is.
+		r := readings[key]
+		if !r.ok {
+			continue
+		}
+		v := r.value
+		if !compare(v, rule.Comparison, rule.Threshold) {
+			state.breachSince = time.Time{}
+			if state.incident != nil {
+				w.resolve(state, now, durationOr(rule.ExpireSeconds, defaultExpiry))
+				changed = append(changed, state.incident)
+				state.incident = nil
+			}
+			continue
+		}
+		if state.breachSince.IsZero() {
+			state.breachSince = now
+		}
+
+		// 2. Already open: track how bad it got
+		if state.incident != nil {
+			if worse(v, state.incident.PeakValue, rule.Comparison) {
+				state.incident.PeakValue = v
+				dirty = true
+			}
+			continue
+		}
+
+		// 3. For long enough?
+		if now.Sub(state.breachSince) < time.Duration(rule.ForSeconds)*time.Second {
+			continue
+		}
+
+		// 4. Check Cooldown (don't spam alerts when a rule flaps)
+		if now.Before(state.cooldownUntil) {
+			continue
+		}
+
+		// BREACH DETECTED
+		state.cooldownUntil = now.Add(durationOr(rule.CooldownSeconds, defaultCooldown))
+		opening = append(opening, breach{rule, key, v, state.breachSince})
+	}
+
+	// Resolve and forget rules removed from the config
+	for key, state := range w.rules {
+		if seen[key] {
+			continue
+		}
+		if state.incident != nil {
+			w.resolve(state, now, defaultExpiry)
+			changed = append(changed, state.incident)
+		}
+		delete(w.rules, key)
+	}
+
+	if len(changed) > 0 || dirty {
+		w.save()
+	}
+
+	result := make([]Incident, len(changed))
+	for i, incident := range changed {
+		result[i] = *incident
+	}
+	w.mu.Unlock()
+
+	if len(opening) == 0 {
+		return result
+	}
+
+	incidents := make([]*Incident, len(opening))
+	for i, b := range opening {
+		incidents[i] = newIncident(b.rule, b.key, b.value, src, b.since, now)
+	}
+
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	// If below threshold, all good
-	if cpuPercent < float64(threshold) {
-		return nil
+	for i, b := range opening {
+		state, ok := w.rules[b.key]
+		if !ok || state.incident != nil {
+			continue // Rule removed, or opened by another check meanwhile
+		}
+		state.incident = incidents[i]
+		w.history = append(w.history, state.incident)
+		w.trimHistory()
+		result = append(result, *state.incident)
+	}
+	w.save()
+	return result
+}
+
+// trimHistory drops the oldest resolved incidents past maxHistory. Open ones
+// are kept, since their rules still update them. Caller holds the write lock.
+func (w *Watchdog) trimHistory() {
+	excess := len(w.history) - maxHistory
+	if excess <= 0 {
+		return
+	}
+
+	kept := w.history[:0]
+	for _, incident := range w.history {
+		if excess > 0 && incident.State == StateResolved {
+			excess--
+			continue
+		}
+		kept = append(kept, incident)
+	}
+	clear(w.history[len(kept):])
+	w.history = kept
+}
+
+func (w *Watchdog) resolve(state *ruleState, now time.Time, expiry time.Duration) {
+	expires := now.Add(expiry)
+	state.incident.State = StateResolved
+	state.incident.EndedAt = &now
+	state.incident.ExpiresAt = &expires
+}
+
+func newIncident(rule config.Rule, key string, v float64, src Sources, breachSince, now time.Time) *Incident {
+	from := breachSince.Add(-suspectLead)
+	var running []nginx.Running
+	if src.Running != nil {
+		running = src.Running()
 	}
+	suspects, lines := findSuspects(src.AccessLog, running, from, now)
 
-	// Check Cooldown (don't spam alerts every second)
-	if time.Now().Before(w.CooldownUntil) {
-		return w.LastIncident
+	var correlation *telemetry.Correlation
+	if src.Correlate != nil {
+		correlation = src.Correlate(rule, from, now)
 	}
 
-	// BREACH DETECTED
-	// Read last 15 lines of log
-	lines, _ := readLastLines(logPath, 15)
+	cpu, _ := src.Value(config.Rule{Metric: MetricFpmCPU})
 
-	w.LastIncident = &Incident{
-		Timestamp:       time.Now(),
-		CpuPercent:      cpuPercent,
+	severity := rule.Severity
+	if severity == "" {
+		severity = defaultSeverity
+	}
+
+	msg := fmt.Sprintf("%s %s %g (value %.2f)", rule.Metric, rule.Comparison, rule.Threshold, v)
+	if rule.ForSeconds > 0 {
+		msg += fmt.Sprintf(" for %ds", rule.ForSeconds)
+	}
+	if rule.Project != "" {
+		msg += " in " + rule.Project
+	}
+
+	return &Incident{
+		ID:              newIncidentID(),
+		State:           StateOpen,
+		Timestamp:       now,
+		Rule:            key,
+		Metric:          rule.Metric,
+		Severity:        severity,
+		Value:           v,
+		PeakValue:       v,
+		Comparison:      rule.Comparison,
+		Threshold:       rule.Threshold,
+		Message:         msg,
+		CpuPercent:      cpu,
 		SuspectRequests: lines,
+		Suspects:        suspects,
+		Correlation:     correlation,
+	}
+}
+
+// findSuspects reads the requests in flight during the breach from the access log,
+// together with the ones still running
+func findSuspects(access AccessLog, running []nginx.Running, from, to time.Time) (*nginx.Suspects, []string) {
+	if (access.Path == "" || access.Format == nil) && len(running) == 0 {
+		return nil, []string{}
+	}
+
+	suspects, err := nginx.FindSuspects(access.Path, access.Format, running, from, to)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("Error reading log: %v", err)}
+	}
+
+	lines := make([]string, len(suspects.Slowest))
+	for i, e := range suspects.Slowest {
+		lines[i] = e.Raw
 	}
+	return suspects, lines
+}
 
-	// Set 1 minute cooldown
-	w.CooldownUntil = time.Now().Add(1 * time.Minute)
+// Acknowledge marks an incident as seen. Resolved incidents keep their state.
+func (w *Watchdog) Acknowledge(id string) (Incident, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	return w.LastIncident
+	for _, incident := range w.history {
+		if incident.ID != id {
+			continue
+		}
+		if incident.AcknowledgedAt == nil {
+			now := time.Now()
+			incident.AcknowledgedAt = &now
+			if incident.State == StateOpen {
+				incident.State = StateAcknowledged
+			}
+			w.save()
+		}
+		return *incident, nil
+	}
+	return Incident{}, ErrIncidentNotFound
 }
 
+// GetLatest returns the most recent incident /alerts should still show
 func (w *Watchdog) GetLatest() *Incident {
+	active := w.Active()
+	if len(active) == 0 {
+		return nil
+	}
+	return &active[0]
+}
+
+// Active returns unresolved incidents and recently resolved ones, newest first
+func (w *Watchdog) Active() []Incident {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
-	// If incident is older than 5 minutes, clear it
-	if w.LastIncident != nil && time.Since(w.LastIncident.Timestamp) > 5*time.Minute {
-		return nil
+	now := time.Now()
+	active := []Incident{}
+	for i := len(w.history) - 1; i >= 0; i-- {
+		incident := w.history[i]
+		if incident.State != StateResolved || (incident.ExpiresAt != nil && now.Before(*incident.ExpiresAt)) {
+			active = append(active, *incident)
+		}
 	}
+	return active
+}
+
+// History returns up to limit logged incidents, newest first, optionally of one state
+func (w *Watchdog) History(state string, limit int) []Incident {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
 
-	return w.LastIncident
+	result := []Incident{}
+	for i := len(w.history) - 1; i >= 0 && len(result) < limit; i-- {
+		if state == "" || w.history[i].State == state {
+			result = append(result, *w.history[i])
+		}
+	}
+	return result
 }
 
-func readLastLines(path string, n int) ([]string, error) {
-	file, err := os.Open(path)
+// save writes the incident log; callers hold the lock
+func (w *Watchdog) save() {
+	if w.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(w.history)
 	if err != nil {
-		return []string{fmt.Sprintf("Error reading log: %v", err)}, err
+		fmt.Printf("[Watchdog] Failed to encode incidents: %v\n", err)
+		return
 	}
-	defer file.Close()
 
-	// Simple approach: Read all lines (inefficient for huge logs, but OK for local dev logs usually)
-	// Better approach for huge logs would be seeking from end, but keeping it simple for MVP.
-	// Actually, let's use a ring buffer scan to avoid loading 1GB file into memory.
+	// Write then rename, so a crash never leaves a truncated log
+	tmp := w.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		fmt.Printf("[Watchdog] Failed to save incidents: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		fmt.Printf("[Watchdog] Failed to save incidents: %v\n", err)
+	}
+}
 
-	// Optimistic approach: Most dev logs aren't huge.
-	// Safe approach: Seek to file size - 10KB and read from there?
+// RuleKey identifies a rule: its name, or its condition when unnamed
+func RuleKey(rule config.Rule) string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	key := fmt.Sprintf("%s %s %g", rule.Metric, rule.Comparison, rule.Threshold)
+	if rule.Project != "" {
+		key += " " + rule.Project
+	}
+	return key
+}
 
-	stat, err := file.Stat()
-	if err == nil && stat.Size() > 20000 {
-		// Seek to near end
-		file.Seek(-20000, 2)
+func compare(v float64, op string, threshold float64) bool {
+	switch op {
+	case ">":
+		return v > threshold
+	case ">=":
+		return v >= threshold
+	case "<":
+		return v < threshold
+	case "<=":
+		return v <= threshold
+	case "==":
+		return v == threshold
+	case "!=":
+		return v != threshold
 	}
+	return false
+}
 
-	scanner := bufio.NewScanner(file)
-	var lines []string
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+// worse reports whether v is further past the threshold than peak
+func worse(v, peak float64, op string) bool {
+	switch op {
+	case "<", "<=":
+		return v < peak
+	case "==":
+		return false
 	}
+	return v > peak
+}
+
+func newIncidentID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
 
-	// Return last N
-	if len(lines) > n {
-		return lines[len(lines)-n:], nil
+func durationOr(seconds int, fallback time.Duration) time.Duration {
+	if seconds <= 0 {
+		return fallback
 	}
-	return lines, nil
+	return time.Duration(seconds) * time.Second
 }
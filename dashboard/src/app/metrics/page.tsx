@@ -58,8 +58,20 @@ export default function Metrics() {
                 <div role="alert" className="alert alert-error bg-red-900/50 border-red-500 text-white shadow-lg">
                     <svg xmlns="http://www.w3.org/2000/svg" className="stroke-current shrink-0 h-6 w-6" fill="none" viewBox="0 0 24 24"><path strokeLinecap="round" strokeLinejoin="round" strokeWidth="2" d="M10 14l2-2m0 0l2-2m-2 2l-2-2m2 2l2 2m7-2a9 9 0 11-18 0 9 9 0 0118 0z" /></svg>
                     <div className="w-full">
-                        <h3 className="font-bold text-lg">High CPU Load Detected!</h3>
-                        <p className="text-sm">PHP-FPM spiked to <span className="font-mono font-bold">{(incident.cpu_percent).toFixed(1)}%</span> at {new Date(incident.timestamp).toLocaleTimeString()}</p>
+                        {incident.metric === 'php_fpm_cpu_percent' ? (
+                            <>
+                                <h3 className="font-bold text-lg">High CPU Load Detected!</h3>
+                                <p className="text-sm">PHP-FPM spiked to <span className="font-mono font-bold">{(incident.cpu_percent).toFixed(1)}%</span> at {new Date(incident.timestamp).toLocaleTimeString()}</p>
+                            </>
+                        ) : (
+                            <>
+                                <h3 className="font-bold text-lg">Alert: {incident.rule}</h3>
+                                <p className="text-sm"><span className="font-mono font-bold">{incident.message}</span> at {new Date(incident.timestamp).toLocaleTimeString()}</p>
+                            </>
+                        )}
+                        {incident.correlation?.routes?.length > 0 && (
+                            <p className="text-sm mt-1">Busiest route: <span className="font-mono font-bold">{incident.correlation.routes[0].method} {incident.correlation.routes[0].route}</span> ({incident.correlation.routes[0].count} runs, {incident.correlation.routes[0].total_ms.toFixed(0)}ms total)</p>
+                        )}
                         
                         <div className="mt-2 p-2 bg-black/40 rounded font-mono text-xs overflow-x-auto max-h-32 text-red-200">
                              <div className="font-bold mb-1 opacity-50">Last {incident.suspect_requests.length} Requests / Log Entries:</div>
@@ -7,6 +7,26 @@ export interface Project {
   path: string;
 }
 
+export interface ProbeConfig {
+  transport: 'http' | 'spool' | 'socket';
+  slow_query_ms: number;
+  sample_rate: number;
+  min_duration_ms: number;
+  capture_bindings: boolean;
+  timeout_ms: number;
+  traces: boolean;
+}
+
+export interface OTLPConfig {
+  endpoint: string;
+  headers?: Record<string, string>;
+  service_name?: string;
+  batch_size: number;
+  flush_interval_ms: number;
+  max_retries: number;
+  metrics: boolean;
+}
+
 export interface Config {
   workspace_root: string;
   host: string;
@@ -14,11 +34,125 @@ export interface Config {
   ignored_projects?: string[];
   cpu_threshold?: number;
   nginx_log_path?: string;
+  nginx_log_format?: string;
   php_fpm_path?: string;
+  php_fpm_address?: string;
+  php_fpm_status_path?: string;
+  metrics_retention_hours?: number;
+  metrics_max_size_mb?: number;
+  n_plus_one_threshold?: number;
+  probe?: ProbeConfig;
+  probe_overrides?: Record<string, Partial<ProbeConfig>>;
+  ingest_rate_limit?: number;
+  spool_path?: string;
+  socket_path?: string;
+  otlp?: OTLPConfig;
+  rules?: WatchdogRule[];
+  notification_sinks?: SinkConfig[];
+}
+
+export interface SinkConfig {
+  name: string;
+  type: 'webhook' | 'slack' | 'desktop' | 'command';
+  url?: string;
+  secret?: string;
+  command?: string;
+  args?: string[];
+  min_severity?: 'info' | 'warning' | 'critical';
+  max_retries?: number;
+  disabled?: boolean;
+}
+
+export interface IngestStats {
+  accepted: number;
+  dropped: number;
+  limit_per_second: number;
+}
+
+export interface OTLPStats {
+  exported: number;
+  dropped: number;
+  failed: number;
+  last_error?: string;
+}
+
+export interface RunnerProcess {
+  port: number;
+  running: boolean;
+  type: string;
+}
+
+// Keyed by "<project path>:web", plus the ingest and export counters
+export type RunnerStatus = Record<string, RunnerProcess> & {
+  ingest?: IngestStats;
+  otlp?: OTLPStats; // Only when an OTLP endpoint is configured
+};
+
+export interface SinkStats {
+  name: string;
+  type: SinkConfig['type'];
+  sent: number;
+  failed: number;
+  dropped: number;
+  last_error?: string;
+}
+
+export interface SinkTestResult {
+  name: string;
+  ok: boolean;
+  error?: string;
+}
+
+export interface WatchdogRule {
+  name: string;
+  metric: string;
+  comparison: '>' | '>=' | '<' | '<=' | '==' | '!=';
+  threshold: number;
+  for_seconds?: number;
+  cooldown_seconds?: number;
+  expire_seconds?: number;
+  severity?: 'info' | 'warning' | 'critical';
+  project?: string;
+  window_seconds?: number;
+  disabled?: boolean;
+}
+
+export interface FpmWorker {
+  pid: number;
+  state: string;
+  start_since_seconds: number;
+  requests: number;
+  request_duration_ms: number;
+  request_method: string;
+  request_uri: string;
+  content_length: number;
+  user: string;
+  script: string;
+  last_request_cpu: number;
+  last_request_memory: number;
+}
+
+export interface FpmStatus {
+  pool: string;
+  process_manager: string;
+  start_since_seconds: number;
+  accepted_conn: number;
+  listen_queue: number;
+  max_listen_queue: number;
+  listen_queue_len: number;
+  idle_processes: number;
+  active_processes: number;
+  total_processes: number;
+  max_active_processes: number;
+  max_children_reached: number;
+  slow_requests: number;
+  workers: FpmWorker[];
 }
 
 export interface TelemetryStatus {
   php_fpm: boolean;
+  php_fpm_status?: FpmStatus;
+  php_fpm_error?: string;
   system_stats: {
     memory_usage_mb: number;
     num_goroutines: number;
@@ -29,10 +163,99 @@ export interface TelemetryStatus {
   };
 }
 
+export interface StatsSample {
+  timestamp: string;
+  php_fpm_cpu_percent: number;
+  php_fpm_cpu_percent_max: number;
+  php_fpm_worker_count: number;
+  php_web_memory_mb: number;
+  php_cli_memory_mb: number;
+  memory_usage_mb: number;
+  num_goroutines: number;
+}
+
+export interface TelemetryHistory {
+  resolution_seconds: number;
+  samples: StatsSample[];
+}
+
+export interface PHPProcess {
+  pid: number;
+  ppid: number;
+  role: 'fpm-master' | 'fpm-worker' | 'cgi' | 'artisan-serve' | 'queue-worker' | 'horizon' | 'schedule' | 'artisan' | 'cli';
+  pool?: string;
+  cpu_percent: number;
+  rss_mb: number;
+  age_seconds: number;
+  cwd?: string;
+  project?: string;
+  cmdline: string;
+}
+
+export interface AccessLogEntry {
+    time: string;
+    remote_addr?: string;
+    method: string;
+    uri: string;
+    status: number;
+    bytes_sent: number;
+    referer?: string;
+    user_agent?: string;
+    request_time_ms: number; // -1 when not logged
+    upstream_response_time_ms: number;
+    raw: string;
+    running?: boolean; // Still being served by FPM, request_time_ms is the time so far
+}
+
+export interface IncidentSuspects {
+    from: string;
+    to: string;
+    total: number;
+    slowest: AccessLogEntry[];
+    frequent: { method: string; path: string; count: number; total_ms: number; max_ms: number }[];
+}
+
+export interface IncidentCorrelation {
+    from: string;
+    to: string;
+    entries: number;
+    routes: { project: string; kind: string; method?: string; route: string; count: number; total_ms: number; p95_ms: number; errors: number }[];
+    slowest: {
+        project: string;
+        kind: string;
+        method?: string;
+        uri?: string;
+        name?: string;
+        status?: number;
+        duration_ms: number;
+        memory_mb: number;
+        query_count: number;
+        timestamp: string;
+        trace_id?: string;
+    }[];
+    slow_queries: { project: string; route: string; sql: string; duration_ms: number; timestamp: string }[];
+    processes: PHPProcess[];
+}
+
 export interface Incident {
+    id: string;
+    state: 'open' | 'acknowledged' | 'resolved';
     timestamp: string;
+    ended_at?: string;
+    acknowledged_at?: string;
+    rule: string;
+    metric: string;
+    severity: 'info' | 'warning' | 'critical';
+    value: number;
+    peak_value: number;
+    comparison: string;
+    threshold: number;
+    message: string;
     cpu_percent: number;
     suspect_requests: string[];
+    suspects?: IncidentSuspects;
+    correlation?: IncidentCorrelation;
+    expires_at?: string;
 }
 
 export interface RoutesParsed {
@@ -48,19 +271,127 @@ export interface LogsParsed {
     lines: string[];
 }
 
+export interface LogEntry {
+    timestamp: string;
+    environment: string;
+    level: string;
+    message: string;
+    context?: Record<string, unknown>;
+    stack_trace?: string[];
+    raw: string;
+}
+
+export interface LogEntriesParsed {
+    entries: LogEntry[];
+}
+
 export interface SlowQuery {
     sql: string;
     duration_ms: number;
 }
 
+export interface QueryFingerprint {
+    sql: string;
+    count: number;
+    total_ms: number;
+}
+
 export interface PerformanceEntry {
+    project: string;
     method: string;
     uri: string;
+    status?: number;
     duration_ms: number;
     memory_mb: number;
     query_count: number;
     slow_queries?: SlowQuery[];
     timestamp: string;
+    route_name?: string;
+    action?: string;
+    user_id?: string;
+    exception?: string;
+    trace_id?: string;
+    query_fingerprints?: QueryFingerprint[];
+    n_plus_one?: QueryFingerprint[];
+    // Queue jobs and artisan commands
+    kind?: 'request' | 'job' | 'command';
+    name?: string;
+    queue?: string;
+    connection?: string;
+    attempts?: number;
+    failed?: boolean;
+    exit_code?: number;
+}
+
+export interface RouteSummary {
+    method: string;
+    route: string;
+    count: number;
+    p50_ms: number;
+    p95_ms: number;
+    p99_ms: number;
+    max_memory_mb: number;
+    mean_queries: number;
+    error_rate: number;
+}
+
+export interface RouteErrors {
+    method: string;
+    route: string;
+    route_name?: string;
+    requests: number;
+    client_errors: number;
+    server_errors: number;
+    exceptions: number;
+    error_rate: number;
+    last_exception?: string;
+    last_seen?: string;
+}
+
+export interface ErrorBucket {
+    start: string;
+    requests: number;
+    errors: number;
+    error_rate: number;
+}
+
+export interface ErrorReport {
+    requests: number;
+    errors: number;
+    error_rate: number;
+    routes: RouteErrors[];
+    timeline: ErrorBucket[];
+}
+
+export interface Span {
+    id: string;
+    parent_id?: string;
+    name: string;
+    kind: 'request' | 'bootstrap' | 'middleware' | 'controller' | 'db' | 'cache' | 'http' | 'view';
+    start_ms: number;
+    duration_ms: number;
+    attributes?: Record<string, unknown>;
+}
+
+export interface Trace {
+    id: string;
+    project: string;
+    method: string;
+    uri: string;
+    status?: number;
+    duration_ms: number;
+    timestamp: string;
+    spans: Span[];
+}
+
+export interface TraceSummary {
+    id: string;
+    method: string;
+    uri: string;
+    status?: number;
+    duration_ms: number;
+    timestamp: string;
+    span_count: number;
 }
 
 export interface DeadlockEntry {
@@ -79,9 +410,71 @@ export const api = {
       }
   },
 
-  fetchPerformance: async (projectPath: string): Promise<PerformanceEntry[]> => {
+  fetchPerformance: async (projectPath: string, status?: string): Promise<PerformanceEntry[]> => {
+      try {
+        const statusParam = status ? `&status=${encodeURIComponent(status)}` : '';
+        const res = await fetch(`${BASE_URL}/projects/performance?path=${encodeURIComponent(projectPath)}${statusParam}`);
+        if(!res.ok) return [];
+        return res.json();
+      } catch {
+        return [];
+      }
+  },
+
+  fetchPerformanceSummary: async (projectPath: string, range = '1h'): Promise<RouteSummary[]> => {
       try {
-        const res = await fetch(`${BASE_URL}/projects/performance?path=${encodeURIComponent(projectPath)}`);
+        const res = await fetch(`${BASE_URL}/projects/performance/summary?path=${encodeURIComponent(projectPath)}&range=${range}`);
+        if(!res.ok) return [];
+        return res.json();
+      } catch {
+        return [];
+      }
+  },
+
+  fetchPerformanceErrors: async (projectPath: string, range = '1h', bucket = '1m'): Promise<ErrorReport | null> => {
+      try {
+        const res = await fetch(`${BASE_URL}/projects/performance/errors?path=${encodeURIComponent(projectPath)}&range=${range}&bucket=${bucket}`);
+        if(!res.ok) return null;
+        return res.json();
+      } catch {
+        return null;
+      }
+  },
+
+  fetchTraces: async (projectPath: string, limit = 50): Promise<TraceSummary[]> => {
+      try {
+        const res = await fetch(`${BASE_URL}/projects/traces?path=${encodeURIComponent(projectPath)}&limit=${limit}`);
+        if(!res.ok) return [];
+        return res.json();
+      } catch {
+        return [];
+      }
+  },
+
+  fetchTrace: async (id: string): Promise<Trace | null> => {
+      try {
+        const res = await fetch(`${BASE_URL}/projects/traces/${encodeURIComponent(id)}`);
+        if(!res.ok) return null;
+        return res.json();
+      } catch {
+        return null;
+      }
+  },
+
+  fetchJobs: async (projectPath: string, kind?: 'job' | 'command'): Promise<PerformanceEntry[]> => {
+      try {
+        const kindParam = kind ? `&kind=${kind}` : '';
+        const res = await fetch(`${BASE_URL}/projects/jobs?path=${encodeURIComponent(projectPath)}${kindParam}`);
+        if(!res.ok) return [];
+        return res.json();
+      } catch {
+        return [];
+      }
+  },
+
+  fetchJobsSummary: async (projectPath: string, range = '1h'): Promise<RouteSummary[]> => {
+      try {
+        const res = await fetch(`${BASE_URL}/projects/jobs/summary?path=${encodeURIComponent(projectPath)}&range=${range}`);
         if(!res.ok) return [];
         return res.json();
       } catch {
@@ -111,7 +504,7 @@ export const api = {
     });
   },
 
-  runnerStatus: async (): Promise<Record<string, { port: number, running: boolean, type: string }>> => {
+  runnerStatus: async (): Promise<RunnerStatus> => {
       try {
         const res = await fetch(`${BASE_URL}/runner/status`);
         return res.json();
@@ -146,6 +539,28 @@ export const api = {
     return res.json();
   },
 
+  fetchTelemetryHistory: async (range = '1h'): Promise<TelemetryHistory> => {
+    const res = await fetch(`${BASE_URL}/telemetry/history?range=${range}`);
+    if (!res.ok) throw new Error('Failed to fetch telemetry history');
+    return res.json();
+  },
+
+  fetchFpmStatus: async (busyOnly = false): Promise<FpmStatus | null> => {
+      try {
+        const res = await fetch(`${BASE_URL}/telemetry/fpm${busyOnly ? '?busy=true' : ''}`);
+        if(!res.ok) return null;
+        return res.json();
+      } catch {
+        return null;
+      }
+  },
+
+  fetchProcesses: async (): Promise<PHPProcess[]> => {
+    const res = await fetch(`${BASE_URL}/telemetry/processes`);
+    if (!res.ok) throw new Error('Failed to fetch processes');
+    return res.json();
+  },
+
   fetchConfig: async (): Promise<Config> => {
     const res = await fetch(`${BASE_URL}/config`);
     if (!res.ok) throw new Error('Failed to fetch config');
@@ -192,6 +607,16 @@ export const api = {
       }
   },
 
+  fetchLogEntries: async (projectPath: string): Promise<LogEntriesParsed> => {
+      try {
+        const res = await fetch(`${BASE_URL}/projects/logs?path=${encodeURIComponent(projectPath)}&format=entries`);
+        if(!res.ok) return { entries: [] };
+        return res.json();
+      } catch {
+        return { entries: [] };
+      }
+  },
+
   proxyRequest: async (method: string, url: string, headers: Record<string, string>, body: string) => {
       const res = await fetch(`${BASE_URL}/proxy`, {
           method: 'POST',
@@ -215,5 +640,49 @@ export const api = {
     } catch {
         return null;
     }
+  },
+
+  fetchActiveAlerts: async (): Promise<Incident[]> => {
+    try {
+        const res = await fetch(`${BASE_URL}/alerts?all=true`);
+        if (!res.ok || res.status === 204) return [];
+        return res.json();
+    } catch {
+        return [];
+    }
+  },
+
+  fetchAlertHistory: async (state?: Incident['state'], limit = 100): Promise<Incident[]> => {
+    try {
+        const stateParam = state ? `&state=${state}` : '';
+        const res = await fetch(`${BASE_URL}/alerts/history?limit=${limit}${stateParam}`);
+        if (!res.ok) return [];
+        return res.json();
+    } catch {
+        return [];
+    }
+  },
+
+  acknowledgeAlert: async (id: string): Promise<Incident> => {
+    const res = await fetch(`${BASE_URL}/alerts/${encodeURIComponent(id)}/ack`, { method: 'POST' });
+    if (!res.ok) throw new Error('Failed to acknowledge alert');
+    return res.json();
+  },
+
+  fetchSinkStats: async (): Promise<SinkStats[]> => {
+    try {
+        const res = await fetch(`${BASE_URL}/alerts/sinks`);
+        if (!res.ok) return [];
+        return res.json();
+    } catch {
+        return [];
+    }
+  },
+
+  testSinks: async (name?: string): Promise<SinkTestResult[]> => {
+    const nameParam = name ? `?name=${encodeURIComponent(name)}` : '';
+    const res = await fetch(`${BASE_URL}/alerts/sinks/test${nameParam}`, { method: 'POST' });
+    if (!res.ok) throw new Error('Failed to test notification sinks');
+    return res.json();
   }
 };